@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Glob is like filepath.Glob, except that a "**" path element matches zero or
+// more directories, so "**/*.go" matches every go file in the tree. Patterns
+// use forward slashes on every OS. The matches are returned in lexical order.
+func Glob(pattern string) ([]string, error) {
+	return GlobSkip(pattern, nil)
+}
+
+// GlobSkip is like Glob, except that files and directories for which skip
+// returns true are left out of the matches, and directories for which it
+// returns true aren't searched. A nil skip skips nothing.
+func GlobSkip(pattern string, skip func(name string, isDir bool) bool) ([]string, error) {
+	pattern = path.Clean(filepath.ToSlash(pattern))
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(filepath.FromSlash(pattern))
+		if err != nil || skip == nil {
+			return matches, err
+		}
+		kept := matches[:0]
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || !skip(m, info.IsDir()) {
+				kept = append(kept, m)
+			}
+		}
+		return kept, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(pattern, "/")
+
+	// only walk the part of the tree the pattern can match.
+	root := "."
+	for i, p := range parts {
+		if hasMeta(p) {
+			if i > 0 {
+				root = strings.Join(parts[:i], "/")
+				if root == "" {
+					root = "/"
+				}
+			}
+			break
+		}
+	}
+
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(root), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == filepath.FromSlash(root) && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if skip != nil && name != filepath.FromSlash(root) && skip(name, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if MatchGlob(parts, strings.Split(filepath.ToSlash(name), "/")) {
+			matches = append(matches, name)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// MatchGlob reports whether the elements of a path match the elements of a
+// pattern, where a "**" element matches zero or more path elements and any
+// other element is matched with path.Match.
+func MatchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if MatchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ExpandBraces expands the brace alternations in pattern, like a shell does,
+// so "*.{go,mod}" gives "*.go" and "*.mod". Alternations can be nested.
+// Braces without a comma in them, and outside of Windows those escaped with a
+// backslash, are left alone.
+func ExpandBraces(pattern string) []string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case '{':
+			alts, end := braceAlternatives(pattern, i)
+			if len(alts) < 2 {
+				continue
+			}
+			var expanded []string
+			for _, alt := range alts {
+				expanded = append(expanded, ExpandBraces(pattern[:i]+alt+pattern[end+1:])...)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// escapes is whether a backslash escapes the next character in patterns, as it
+// does everywhere but on Windows, where it is the path separator.
+const escapes = filepath.Separator != '\\'
+
+// braceAlternatives splits the alternation that starts with the brace at
+// pattern[start] at its top level commas, and returns them with the index of
+// the closing brace. It returns no alternatives if the brace isn't closed.
+func braceAlternatives(pattern string, start int) ([]string, int) {
+	var alts []string
+	depth, last := 0, start+1
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alts = append(alts, pattern[last:i])
+				last = i + 1
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				return append(alts, pattern[last:i]), i
+			}
+		}
+	}
+	return nil, 0
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
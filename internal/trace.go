@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEnv is the environment variable holding the path of the file trace
+// events are written to. The compiled magefile creates the file and sets the
+// variable when it is run with -trace.
+const TraceEnv = "MAGEFILE_TRACE"
+
+// TraceEvent is an event in the Chrome trace event format, which can be loaded
+// in Perfetto or chrome://tracing. The file is a JSON array of events, which
+// the compiled magefile opens and closes, and every package that records events
+// appends to.
+type TraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"`
+	Dur  int64                  `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  uint64                 `json:"tid"`
+	S    string                 `json:"s,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+var tracer = struct {
+	mu    sync.Mutex
+	path  string
+	f     *os.File
+	lanes map[uint64]bool
+}{}
+
+// Tracing reports whether trace events are being recorded.
+func Tracing() bool {
+	return os.Getenv(TraceEnv) != ""
+}
+
+// Trace appends the event to the trace file, if tracing is enabled. Events are
+// written one per line, each followed by a comma, so that the file is a valid
+// JSON array once the compiled magefile writes the closing bracket.
+func Trace(e TraceEvent) {
+	path := os.Getenv(TraceEnv)
+	if path == "" {
+		return
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if tracer.path != path {
+		if tracer.f != nil {
+			tracer.f.Close()
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			debug.Println("can't open trace file:", err)
+			return
+		}
+		tracer.path, tracer.f, tracer.lanes = path, f, map[uint64]bool{}
+	}
+	if e.Pid == 0 {
+		e.Pid = os.Getpid()
+	}
+	if !tracer.lanes[e.Tid] {
+		// name the lane after the goroutine the first time it is used.
+		tracer.lanes[e.Tid] = true
+		writeTraceEvent(tracer.f, TraceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  e.Pid,
+			Tid:  e.Tid,
+			Args: map[string]interface{}{"name": "goroutine " + strconv.FormatUint(e.Tid, 10)},
+		})
+	}
+	writeTraceEvent(tracer.f, e)
+}
+
+func writeTraceEvent(f *os.File, e TraceEvent) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		debug.Println("can't encode trace event:", err)
+		return
+	}
+	// a single write per event, so events appended by the compiled magefile
+	// through its own handle to the file never interleave with ours.
+	if _, err := f.Write(append(b, ",\n"...)); err != nil {
+		debug.Println("can't write trace event:", err)
+	}
+}
+
+// TraceSpan records the start of a complete ("X") event on the lane of the
+// calling goroutine. The returned function records its end, with the given
+// status and extra args.
+func TraceSpan(cat, name string) func(status string, args map[string]interface{}) {
+	if !Tracing() {
+		return func(string, map[string]interface{}) {}
+	}
+	tid := Goid()
+	start := time.Now()
+	return func(status string, args map[string]interface{}) {
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		args["status"] = status
+		Trace(TraceEvent{
+			Name: name,
+			Cat:  cat,
+			Ph:   "X",
+			Ts:   start.UnixMicro(),
+			Dur:  time.Since(start).Microseconds(),
+			Tid:  tid,
+			Args: args,
+		})
+	}
+}
+
+// TraceInstant records an instant ("i") event on the lane of the calling
+// goroutine.
+func TraceInstant(cat, name string, args map[string]interface{}) {
+	if !Tracing() {
+		return
+	}
+	Trace(TraceEvent{
+		Name: name,
+		Cat:  cat,
+		Ph:   "i",
+		S:    "t",
+		Ts:   time.Now().UnixMicro(),
+		Tid:  Goid(),
+		Args: args,
+	})
+}
+
+// Goid returns the id of the calling goroutine. The runtime doesn't expose it
+// directly, so it is parsed from the first line of the goroutine's stack trace,
+// which looks like "goroutine 42 [running]:".
+func Goid() uint64 {
+	var buf [64]byte
+	s := string(buf[:runtime.Stack(buf[:], false)])
+	s = strings.TrimPrefix(s, "goroutine ")
+	if i := strings.IndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	id, _ := strconv.ParseUint(s, 10, 64)
+	return id
+}
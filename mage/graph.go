@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/actualyze-ai/mage/parse"
+)
+
+// The formats supported by the -graph flag.
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+	GraphJSON    = "json"
+)
+
+// graphNode is a function in the dependency graph of a magefile.
+type graphNode struct {
+	Name   string `json:"name"`
+	Target bool   `json:"target"`
+}
+
+// graphEdge is a dependency of one function on another.
+type graphEdge struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Args   []string `json:"args,omitempty"`
+	Serial bool     `json:"serial,omitempty"`
+}
+
+// depGraph is the static dependency graph of a magefile, as declared by calls
+// to mg.Deps and friends in the bodies of its functions.
+type depGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphFunc is a function that may appear in the graph.
+type graphFunc struct {
+	name   string // the name shown in the graph
+	target bool
+	prefix string // the prefix of functions in the same package
+	deps   []parse.Dep
+}
+
+// newDepGraph builds the dependency graph of the given package. If root is not
+// empty, the graph only contains root and its transitive dependencies.
+func newDepGraph(info *parse.PkgInfo, root string) (depGraph, error) {
+	for alias, f := range info.Aliases {
+		if root != "" && strings.EqualFold(root, alias) {
+			root = f.TargetName()
+		}
+	}
+	funcs := map[string]*graphFunc{}
+	var roots []string
+	addPkg := func(prefix string, pi parse.PkgInfo) {
+		for key, deps := range pi.Deps {
+			funcs[prefix+key] = &graphFunc{name: prefix + key, prefix: prefix, deps: deps}
+		}
+		for _, f := range pi.Funcs {
+			key := prefix + f.Name
+			if f.Receiver != "" {
+				key = prefix + f.Receiver + "." + f.Name
+			}
+			funcs[key] = &graphFunc{name: f.TargetName(), target: true, prefix: prefix, deps: f.Deps}
+			if root == "" || strings.EqualFold(root, f.TargetName()) {
+				roots = append(roots, key)
+			}
+		}
+	}
+	addPkg("", *info)
+	imports := map[string]bool{}
+	for _, imp := range info.Imports {
+		imports[imp.Name] = true
+		addPkg(imp.Name+".", imp.Info)
+	}
+	if len(roots) == 0 && root != "" {
+		return depGraph{}, fmt.Errorf("unknown target %q", root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return funcs[roots[i]].name < funcs[roots[j]].name
+	})
+
+	// resolve returns the key of the function a dependency refers to.
+	resolve := func(from *graphFunc, dep parse.Dep) string {
+		if _, ok := funcs[from.prefix+dep.Name]; ok {
+			return from.prefix + dep.Name
+		}
+		if pkg, _, ok := strings.Cut(dep.Name, "."); ok && from.prefix == "" && imports[pkg] {
+			return dep.Name
+		}
+		return from.prefix + dep.Name
+	}
+
+	g := depGraph{}
+	seen := map[string]bool{}
+	edges := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		f, ok := funcs[key]
+		if !ok {
+			// not a function we know about, e.g. a variable or closure.
+			g.Nodes = append(g.Nodes, graphNode{Name: key})
+			return
+		}
+		g.Nodes = append(g.Nodes, graphNode{Name: f.name, Target: f.target})
+		for _, dep := range f.deps {
+			to := resolve(f, dep)
+			name := to
+			if t, ok := funcs[to]; ok {
+				name = t.name
+			}
+			e := graphEdge{From: f.name, To: name, Args: dep.Args, Serial: dep.Serial}
+			id := fmt.Sprintf("%s\x00%s\x00%q\x00%v", e.From, e.To, e.Args, e.Serial)
+			if !edges[id] {
+				edges[id] = true
+				g.Edges = append(g.Edges, e)
+			}
+			visit(to)
+		}
+	}
+	for _, key := range roots {
+		visit(key)
+	}
+	return g, nil
+}
+
+// writeGraph writes the graph in the given format.
+func writeGraph(w io.Writer, g depGraph, format string) error {
+	switch format {
+	case GraphDOT:
+		return writeDOT(w, g)
+	case GraphMermaid:
+		return writeMermaid(w, g)
+	case GraphJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	default:
+		return fmt.Errorf("unknown graph format %q", format)
+	}
+}
+
+func writeDOT(w io.Writer, g depGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph mage {\n")
+	for _, n := range g.Nodes {
+		if n.Target {
+			fmt.Fprintf(&b, "\t%s [shape=box];\n", strconv.Quote(n.Name))
+		} else {
+			fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(n.Name))
+		}
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if len(e.Args) > 0 {
+			attrs = append(attrs, "label="+strconv.Quote(strings.Join(e.Args, ", ")))
+		}
+		if e.Serial {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "\t%s -> %s", strconv.Quote(e.From), strconv.Quote(e.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMermaid(w io.Writer, g depGraph) error {
+	// mermaid node ids can't contain most punctuation, so number the nodes
+	// and use the names as labels.
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	for i, n := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.Name] = id
+		if n.Target {
+			fmt.Fprintf(&b, "\t%s[\"%s\"]\n", id, mermaidEscape(n.Name))
+		} else {
+			fmt.Fprintf(&b, "\t%s(\"%s\")\n", id, mermaidEscape(n.Name))
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Serial {
+			arrow = "-.->"
+		}
+		label := ""
+		if len(e.Args) > 0 {
+			label = fmt.Sprintf("|\"%s\"|", mermaidEscape(strings.Join(e.Args, ", ")))
+		}
+		fmt.Fprintf(&b, "\t%s %s%s %s\n", ids[e.From], arrow, label, ids[e.To])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
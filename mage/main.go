@@ -111,8 +111,15 @@ type Invocation struct {
 	Verbose    bool          // tells the magefile to print out log statements
 	List       bool          // tells the magefile to print out a list of targets
 	Help       bool          // tells the magefile to print out help for a specific target
+	Graph      bool          // tells mage to print the dependency graph of the magefiles instead of running them
+	GraphFmt   string        // the format to print the dependency graph in: dot, mermaid or json
 	Keep       bool          // tells mage to keep the generated main file after compiling
 	Timeout    time.Duration // tells mage to set a timeout to running the targets
+	Jobs       int           // tells the magefile how many dependencies may run in parallel
+	FailFast   bool          // tells the magefile to cancel sibling dependencies after the first failure
+	Trace      string        // tells the magefile to write a trace of the run to this file
+	Timings    bool          // tells the magefile to print how long each target and dependency took
+	Output     string        // tells the magefile how to write the output of dependencies: raw, prefixed or grouped
 	CompileOut string        // tells mage to compile a static binary to this path, but not execute
 	GOOS       string        // sets the GOOS when producing a binary with -compileout
 	GOARCH     string        // sets the GOARCH when producing a binary with -compileout
@@ -196,6 +203,11 @@ func Parse(stderr, stdout io.Writer, args []string) (inv Invocation, cmd Command
 	fs.BoolVar(&inv.Verbose, "v", mg.Verbose(), "show verbose output when running mage targets")
 	fs.BoolVar(&inv.Help, "h", false, "show this help")
 	fs.DurationVar(&inv.Timeout, "t", 0, "timeout in duration parsable format (e.g. 5m30s)")
+	fs.IntVar(&inv.Jobs, "j", mg.Jobs(), "maximum number of dependencies to run in parallel")
+	fs.BoolVar(&inv.FailFast, "failfast", mg.FailFast(), "cancel the remaining dependencies after the first one fails")
+	fs.StringVar(&inv.Trace, "trace", mg.TraceFile(), "write a trace of the run to the given file, in Chrome trace format")
+	fs.BoolVar(&inv.Timings, "timings", mg.Timings(), "print how long each target and dependency took after the run")
+	fs.StringVar(&inv.Output, "output", os.Getenv(mg.OutputEnv), "how to write the output of commands run by dependencies: raw, prefixed or grouped")
 	fs.BoolVar(&inv.Keep, "keep", false, "keep intermediate mage files around after running")
 	fs.StringVar(&inv.Dir, "d", "", "directory to read magefiles from")
 	fs.StringVar(&inv.WorkDir, "w", "", "working directory where magefiles will run")
@@ -215,6 +227,8 @@ func Parse(stderr, stdout io.Writer, args []string) (inv Invocation, cmd Command
 	fs.BoolVar(&clean, "clean", false, "clean out old generated binaries from CACHE_DIR")
 	var compileOutPath string
 	fs.StringVar(&compileOutPath, "compile", "", "output a static binary to the given path")
+	fs.BoolVar(&inv.Graph, "graph", false, "print the dependency graph of the magefiles, or of the given target")
+	fs.StringVar(&inv.GraphFmt, "graphfmt", GraphDOT, "format to print the dependency graph in: dot, mermaid or json")
 
 	fs.Usage = func() {
 		fmt.Fprint(stdout, `
@@ -226,6 +240,8 @@ Commands:
   -clean    clean out old generated binaries from CACHE_DIR
   -compile <string>
             output a static binary to the given path
+  -graph [target]
+            print the dependency graph of the magefiles, or of the given target
   -h        show this help
   -init     create a starting template if no mage files exist
   -l        list mage targets in this directory
@@ -236,15 +252,26 @@ Options:
             directory to read magefiles from (default "." or "magefiles" if exists)
   -debug    turn on debug messages
   -f        force recreation of compiled magefile
+  -failfast cancel the remaining dependencies after the first one fails
   -goarch   sets the GOARCH for the binary created by -compile (default: current arch)
   -gocmd <string>
 		    use the given go binary to compile the output (default: "go")
+  -graphfmt <string>
+            format to print the dependency graph in: dot, mermaid or json (default: "dot")
   -goos     sets the GOOS for the binary created by -compile (default: current OS)
   -ldflags  sets the ldflags for the binary created by -compile (default: "")
   -h        show description of a target
+  -j <int>
+            maximum number of dependencies to run in parallel (default: no limit)
   -keep     keep intermediate mage files around after running
+  -output <string>
+            how to write the output of commands run by dependencies: raw,
+            prefixed or grouped (default: "raw")
   -t <string>
             timeout in duration parsable format (e.g. 5m30s)
+  -timings  print how long each target and dependency took after the run
+  -trace <string>
+            write a trace of the run to the given file, in Chrome trace format
   -v        show verbose output when running mage targets
   -w <string>
             working directory where magefiles will run (default -d value)
@@ -279,12 +306,15 @@ Options:
 		cmd = Clean
 		if fs.NArg() > 0 {
 			// Temporary dupe of below check until we refactor the other commands to use this check
-			return inv, cmd, errors.New("-h, -init, -clean, -compile and -version cannot be used simultaneously")
+			return inv, cmd, errors.New("-h, -init, -clean, -compile, -graph and -version cannot be used simultaneously")
 		}
 	}
 	if inv.Help {
 		numCommands++
 	}
+	if inv.Graph {
+		numCommands++
+	}
 
 	if inv.Debug {
 		debug.SetOutput(stderr)
@@ -294,7 +324,11 @@ Options:
 
 	if numCommands > 1 {
 		debug.Printf("%d commands defined", numCommands)
-		return inv, cmd, errors.New("-h, -init, -clean, -compile and -version cannot be used simultaneously")
+		return inv, cmd, errors.New("-h, -init, -clean, -compile, -graph and -version cannot be used simultaneously")
+	}
+
+	if inv.Jobs < 0 {
+		return inv, cmd, errors.New("-j must not be negative")
 	}
 
 	if cmd != CompileStatic && (inv.GOARCH != "" || inv.GOOS != "") {
@@ -305,6 +339,19 @@ Options:
 	if inv.Help && len(inv.Args) > 1 {
 		return inv, cmd, errors.New("-h can only show help for a single target")
 	}
+	if inv.Graph && len(inv.Args) > 1 {
+		return inv, cmd, errors.New("-graph can only show the graph of a single target")
+	}
+	switch inv.Output {
+	case "", mg.OutputRaw, mg.OutputPrefixed, mg.OutputGrouped:
+	default:
+		return inv, cmd, fmt.Errorf("unknown output mode %q, must be one of raw, prefixed or grouped", inv.Output)
+	}
+	switch inv.GraphFmt {
+	case GraphDOT, GraphMermaid, GraphJSON:
+	default:
+		return inv, cmd, fmt.Errorf("unknown graph format %q, must be one of dot, mermaid or json", inv.GraphFmt)
+	}
 
 	if len(inv.Args) > 0 && cmd != None {
 		return inv, cmd, fmt.Errorf("unexpected arguments to command: %q", inv.Args)
@@ -362,6 +409,9 @@ func Invoke(inv Invocation) int {
 		return 1
 	}
 	debug.Printf("found magefiles: %s", strings.Join(files, ", "))
+	if inv.Graph {
+		return Graph(inv, files, errlog)
+	}
 	exePath := inv.CompileOut
 	if inv.CompileOut == "" {
 		exePath, err = ExeName(inv.GoCmd, inv.CacheDir, files)
@@ -462,6 +512,41 @@ func Invoke(inv Invocation) int {
 	return RunCompiled(inv, exePath, errlog)
 }
 
+// Graph prints the dependency graph of the given magefiles, or of the target
+// given in inv.Args, to inv.Stdout without compiling or running anything.
+func Graph(inv Invocation, files []string, errlog *log.Logger) int {
+	fnames := make([]string, 0, len(files))
+	for i := range files {
+		fnames = append(fnames, filepath.Base(files[i]))
+	}
+	if inv.Debug {
+		parse.EnableDebug()
+	}
+	info, err := parse.PrimaryPackage(inv.GoCmd, inv.Dir, fnames)
+	if err != nil {
+		errlog.Println("Error parsing magefiles:", err)
+		return 1
+	}
+	root := ""
+	if len(inv.Args) > 0 {
+		root = inv.Args[0]
+	}
+	g, err := newDepGraph(info, root)
+	if err != nil {
+		errlog.Println("Error:", err)
+		return 2
+	}
+	format := inv.GraphFmt
+	if format == "" {
+		format = GraphDOT
+	}
+	if err := writeGraph(inv.Stdout, g, format); err != nil {
+		errlog.Println("Error:", err)
+		return 1
+	}
+	return 0
+}
+
 type mainfileTemplateData struct {
 	Description string
 	Funcs       []*parse.Function
@@ -469,6 +554,9 @@ type mainfileTemplateData struct {
 	Aliases     map[string]*parse.Function
 	Imports     []*parse.Import
 	BinaryName  string
+
+	BeforeTarget bool // whether the magefiles declare a BeforeTarget hook
+	AfterTarget  bool // whether the magefiles declare an AfterTarget hook
 }
 
 // listGoFiles returns a list of all .go files in a given directory,
@@ -626,6 +714,9 @@ func GenerateMainfile(binaryName, path string, info *parse.PkgInfo) error {
 		Aliases:     info.Aliases,
 		Imports:     info.Imports,
 		BinaryName:  binaryName,
+
+		BeforeTarget: info.BeforeTarget,
+		AfterTarget:  info.AfterTarget,
 	}
 
 	if info.DefaultFunc != nil {
@@ -738,6 +829,28 @@ func RunCompiled(inv Invocation, exePath string, errlog *log.Logger) int {
 	if inv.Timeout > 0 {
 		c.Env = append(c.Env, fmt.Sprintf("MAGEFILE_TIMEOUT=%s", inv.Timeout.String()))
 	}
+	if inv.Jobs > 0 {
+		c.Env = append(c.Env, fmt.Sprintf("MAGEFILE_JOBS=%d", inv.Jobs))
+	}
+	if inv.FailFast {
+		c.Env = append(c.Env, "MAGEFILE_FAILFAST=1")
+	}
+	if inv.Timings {
+		c.Env = append(c.Env, "MAGEFILE_TIMINGS=1")
+	}
+	if inv.Output != "" {
+		c.Env = append(c.Env, fmt.Sprintf("MAGEFILE_OUTPUT=%s", inv.Output))
+	}
+	if inv.Trace != "" {
+		// the magefile may run in a different directory, so make the path
+		// relative to where mage was run.
+		trace, err := filepath.Abs(inv.Trace)
+		if err != nil {
+			errlog.Printf("failed to resolve trace file: %v", err)
+			return 1
+		}
+		c.Env = append(c.Env, fmt.Sprintf("MAGEFILE_TRACE=%s", trace))
+	}
 	debug.Print("running magefile with mage vars:\n", strings.Join(filter(c.Env, "MAGEFILE"), "\n"))
 	// catch SIGINT to allow magefile to handle them
 	sigCh := make(chan os.Signal, 1)
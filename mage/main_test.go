@@ -12,6 +12,7 @@ import (
 	"debug/macho"
 	"debug/pe"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"go/build"
@@ -1035,6 +1036,30 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseJobs(t *testing.T) {
+	inv, _, err := Parse(io.Discard, io.Discard, []string{"-j", "4", "build"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if inv.Jobs != 4 {
+		t.Errorf("expected jobs to be 4 but was %d", inv.Jobs)
+	}
+	_, _, err = Parse(io.Discard, io.Discard, []string{"-j", "-1", "build"})
+	if err == nil {
+		t.Fatal("expected error for negative -j")
+	}
+}
+
+func TestParseFailFast(t *testing.T) {
+	inv, _, err := Parse(io.Discard, io.Discard, []string{"-failfast", "build"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !inv.FailFast {
+		t.Error("expected failfast to be true")
+	}
+}
+
 func TestSetDir(t *testing.T) {
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
@@ -1882,6 +1907,420 @@ func TestWrongDependency(t *testing.T) {
 	}
 }
 
+func TestDepsError(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/deps_error",
+		Stderr: stderr,
+		Stdout: io.Discard,
+	}
+	code := Invoke(inv)
+	if code != 3 {
+		t.Fatalf("expected 3, but got %v", code)
+	}
+	expected := "Error: 1 dependency failed:\n  Lint: lint failed\n"
+	actual := stderr.String()
+	if actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:      "./testdata/graph",
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Graph:    true,
+		GraphFmt: GraphDOT,
+		Args:     []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	expected := `digraph mage {
+	"Build" [shape=box];
+	"Docs:Generate" [shape=box];
+	"tools";
+	"compile";
+	"Build" -> "Docs:Generate";
+	"Docs:Generate" -> "tools";
+	"Build" -> "compile" [label="\"server\""];
+	"compile" -> "tools";
+	"Build" -> "tools" [style=dashed];
+}
+`
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+
+	stdout.Reset()
+	inv.GraphFmt = GraphMermaid
+	inv.Args = []string{"lint"}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	expected = "graph TD\n\tn0[\"Lint\"]\n"
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestParseGraph(t *testing.T) {
+	inv, _, err := Parse(io.Discard, io.Discard, []string{"-graph", "-graphfmt", "json", "build"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !inv.Graph || inv.GraphFmt != GraphJSON {
+		t.Errorf("expected json graph, but got graph=%v graphfmt=%q", inv.Graph, inv.GraphFmt)
+	}
+	if _, _, err := Parse(io.Discard, io.Discard, []string{"-graph", "-graphfmt", "svg"}); err == nil {
+		t.Error("expected error for unknown graph format")
+	}
+	if _, _, err := Parse(io.Discard, io.Discard, []string{"-graph", "a", "b"}); err == nil {
+		t.Error("expected error for more than one target")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	trace := filepath.Join(t.TempDir(), "trace.json")
+	inv := Invocation{
+		Dir:    "./testdata/trace",
+		Stdout: io.Discard,
+		Stderr: stderr,
+		Trace:  trace,
+		Args:   []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	b, err := os.ReadFile(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []struct {
+		Name string
+		Cat  string
+		Ph   string
+		Args map[string]interface{}
+	}
+	if err := json.Unmarshal(b, &events); err != nil {
+		t.Fatalf("trace is not valid JSON: %v\n%s", err, b)
+	}
+	found := map[string]bool{}
+	for _, e := range events {
+		if e.Ph == "M" {
+			continue
+		}
+		if e.Args["status"] != "ok" {
+			t.Errorf("expected %s %q to be ok, got %v", e.Cat, e.Name, e.Args["status"])
+		}
+		if e.Cat == "exec" {
+			e.Name = "exec"
+		}
+		found[e.Cat+":"+e.Ph+":"+e.Name] = true
+	}
+	for _, s := range []string{
+		"target:X:Build",
+		"dep:X:Generate",
+		"dep:X:Compile",
+		"dep:i:Generate",
+		"exec:X:exec",
+	} {
+		if !found[s] {
+			t.Errorf("expected trace to contain %s event, got %s", s, b)
+		}
+	}
+}
+
+func TestTraceNested(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	trace := filepath.Join(t.TempDir(), "trace.json")
+	inv := Invocation{
+		Dir:    "./testdata/nested_trace",
+		Stdout: io.Discard,
+		Stderr: stderr,
+		Trace:  trace,
+		Args:   []string{"outer"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	b, err := os.ReadFile(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []struct {
+		Name string
+		Cat  string
+		Ph   string
+	}
+	if err := json.Unmarshal(b, &events); err != nil {
+		t.Fatalf("trace is not valid JSON: %v\n%s", err, b)
+	}
+	found := map[string]bool{}
+	for _, e := range events {
+		found[e.Cat+":"+e.Ph+":"+e.Name] = true
+	}
+	for _, s := range []string{
+		"target:X:Outer",
+		"dep:X:Prepare",
+		"target:X:Inner",
+		"dep:X:Cleanup",
+	} {
+		if !found[s] {
+			t.Errorf("expected trace to contain %s event, got %s", s, b)
+		}
+	}
+}
+
+func TestTimings(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "./testdata/trace",
+		Stdout:  io.Discard,
+		Stderr:  stderr,
+		Timings: true,
+		Args:    []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	for _, re := range []string{
+		`(?m)^NAME +KIND +TIME +STATUS +CACHED$`,
+		`(?m)^Build +target +\S+ +ok +no$`,
+		`(?m)^Generate +dep +\S+ +ok +no$`,
+		`(?m)^Compile +dep +\S+ +ok +no$`,
+		`(?m)^Generate +dep +\S+ +ok +yes$`,
+	} {
+		if !regexp.MustCompile(re).MatchString(stderr.String()) {
+			t.Errorf("expected timings to match %s, got:\n%s", re, stderr)
+		}
+	}
+}
+
+func TestTimingsNested(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "./testdata/nested_trace",
+		Stdout:  io.Discard,
+		Stderr:  stderr,
+		Timings: true,
+		Args:    []string{"outer"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	if n := strings.Count(stderr.String(), "NAME"); n != 1 {
+		t.Errorf("expected a single table of timings, got %d:\n%s", n, stderr)
+	}
+	for _, re := range []string{
+		`(?m)^Outer +target +\S+ +ok +no$`,
+		`(?m)^Prepare +dep +\S+ +ok +no$`,
+		`(?m)^Inner +target +\S+ +ok +no$`,
+		`(?m)^Cleanup +dep +\S+ +ok +no$`,
+	} {
+		if !regexp.MustCompile(re).MatchString(stderr.String()) {
+			t.Errorf("expected timings to match %s, got:\n%s", re, stderr)
+		}
+	}
+}
+
+func TestTimingsUnreadable(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "./testdata/nested_trace",
+		Stdout:  io.Discard,
+		Stderr:  stderr,
+		Timings: true,
+		Args:    []string{"corrupt"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stderr.String(), "warning: can't print timings:") {
+		t.Errorf("expected a warning about the timings without -v, got:\n%s", stderr)
+	}
+}
+
+func TestDepsTargetContext(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "./testdata/target_context",
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Timeout: time.Minute,
+		Args:    []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	expected := "deadline: true\n"
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		target string
+		code   int
+		stdout string
+	}{
+		{"build", 0, "before Build\nbuilding\nafter Build: <nil>\n"},
+		{"fail", 1, "before Fail\nafter Fail: failed\n"},
+		{"denied", 1, "before Denied\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			inv := Invocation{
+				Dir:    "./testdata/hooks",
+				Stdout: stdout,
+				Stderr: stderr,
+				Args:   []string{tt.target},
+			}
+			code := Invoke(inv)
+			if code != tt.code {
+				t.Fatalf("expected %v, but got %v, stderr: %s", tt.code, code, stderr)
+			}
+			if actual := stdout.String(); actual != tt.stdout {
+				t.Fatalf("expected %q, but got %q", tt.stdout, actual)
+			}
+		})
+	}
+}
+
+func TestOutputPrefixed(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/output",
+		Stdout: stdout,
+		Stderr: stderr,
+		Output: "prefixed",
+		Args:   []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %s", code, stderr)
+	}
+	for _, line := range []string{
+		"[GoOS] " + runtime.GOOS + "\n",
+		"[GoArch] " + runtime.GOARCH + "\n",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected output to contain %q, got %q", line, stdout)
+		}
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	_, _, err := Parse(io.Discard, io.Discard, []string{"-output", "fancy"})
+	expected := `unknown output mode "fancy", must be one of raw, prefixed or grouped`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/stderr_tail",
+		Stdout: io.Discard,
+		Stderr: stderr,
+		Args:   []string{"build"},
+	}
+	code := Invoke(inv)
+	if code != 2 {
+		t.Fatalf("expected 2, but got %v, stderr: %s", code, stderr)
+	}
+	_, after, ok := strings.Cut(stderr.String(), "Error: ")
+	if !ok {
+		t.Fatalf("expected an error, got %q", stderr)
+	}
+	if !strings.Contains(after, "stderr of "+mg.GoCmd()+" bogus:\n    go bogus: unknown command") {
+		t.Fatalf("expected the stderr of the command under the error, got %q", after)
+	}
+}
+
+func TestAtExit(t *testing.T) {
+	tests := []struct {
+		target string
+		code   int
+		stdout string
+	}{
+		{"build", 0, "building\nsecond hook\nfirst hook\n"},
+		{"fail", 1, "cleanup\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			inv := Invocation{
+				Dir:    "./testdata/atexit",
+				Stdout: stdout,
+				Stderr: stderr,
+				Args:   []string{tt.target},
+			}
+			code := Invoke(inv)
+			if code != tt.code {
+				t.Fatalf("expected %v, but got %v, stderr: %s", tt.code, code, stderr)
+			}
+			if actual := stdout.String(); actual != tt.stdout {
+				t.Fatalf("expected %q, but got %q", tt.stdout, actual)
+			}
+		})
+	}
+}
+
+func TestBadArgsAfterTargets(t *testing.T) {
+	for _, args := range [][]string{
+		{"build", "nosuchtarget"},
+		{"build", "greet"},
+	} {
+		t.Run(args[1], func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			trace := filepath.Join(t.TempDir(), "trace.json")
+			inv := Invocation{
+				Dir:    "./testdata/atexit",
+				Stdout: stdout,
+				Stderr: stderr,
+				Trace:  trace,
+				Args:   args,
+			}
+			code := Invoke(inv)
+			if code != 2 {
+				t.Fatalf("expected 2, but got %v, stderr: %s", code, stderr)
+			}
+			// the target that ran before the bad argument is cleaned up after.
+			if want := "building\nsecond hook\nfirst hook\n"; stdout.String() != want {
+				t.Fatalf("expected %q, but got %q", want, stdout)
+			}
+			b, err := os.ReadFile(trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var events []interface{}
+			if err := json.Unmarshal(b, &events); err != nil {
+				t.Fatalf("trace is not valid JSON: %v\n%s", err, b)
+			}
+		})
+	}
+}
+
 // Regression tests, add tests to ensure we do not regress on known issues.
 
 // TestBug508 is a regression test for: Bug: using Default with imports selects first matching func by name
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	_json "encoding/json"
 	_flag "flag"
 	_fmt "fmt"
 	_io "io"
@@ -26,6 +27,7 @@ import (
 	_sort "sort"
 	"strconv"
 	_strings "strings"
+	_sync "sync"
 	"syscall"
 	_tabwriter "text/tabwriter"
 	"time"
@@ -33,6 +35,47 @@ import (
 	{{end}}
 )
 
+// _mageTargetContext hands the context of the running target to the mg package,
+// which looks it up by name in flag.CommandLine so that mg.Deps can pass it on
+// to dependencies. This way the mainfile doesn't need to import mg.
+type _mageTargetContext struct {
+	ctx context.Context
+}
+
+func (c *_mageTargetContext) String() string   { return "" }
+func (c *_mageTargetContext) Set(string) error { return _fmt.Errorf("can't be set from the command line") }
+func (c *_mageTargetContext) Get() interface{} { return c.ctx }
+
+// _mageExitHooks holds the functions the mg package registers to be called when
+// the binary exits. Like _mageTargetContext, it is looked up by name in
+// flag.CommandLine, and Get returns the function that registers them.
+type _mageExitHooks struct {
+	mu  _sync.Mutex
+	fns []func()
+}
+
+func (h *_mageExitHooks) String() string   { return "" }
+func (h *_mageExitHooks) Set(string) error { return _fmt.Errorf("can't be set from the command line") }
+func (h *_mageExitHooks) Get() interface{} { return h.add }
+
+func (h *_mageExitHooks) add(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fn)
+}
+
+// run calls the registered functions, most recently registered first. Each is
+// only called once, however often run is called.
+func (h *_mageExitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
 func main() {
 	// Use local types and functions in order to avoid name conflicts with additional magefiles.
 	type arguments struct {
@@ -40,6 +83,11 @@ func main() {
 		List          bool          // print out a list of targets
 		Help          bool          // print out help for a specific target
 		Timeout       time.Duration // set a timeout to running the targets
+		Jobs          int           // limit the number of dependencies run in parallel
+		FailFast      bool          // cancel sibling dependencies after the first failure
+		Trace         string        // write a trace of the run to this file
+		Timings       bool          // print how long each target and dependency took
+		Output        string        // how to write the output of dependencies: raw, prefixed or grouped
 		Args          []string      // args contain the non-flag command-line arguments
 	}
 
@@ -68,6 +116,20 @@ func main() {
 		}
 		return d
 	}
+
+	parseInt := func(env string) int {
+		val := os.Getenv(env)
+		if val == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			_log.Printf("warning: environment variable %s is not a valid int value: %v", env, val)
+			return 0
+		}
+		return n
+	}
+
 	args := arguments{}
 	fs := _flag.FlagSet{}
 	fs.SetOutput(os.Stdout)
@@ -77,6 +139,11 @@ func main() {
 	fs.BoolVar(&args.List, "l", parseBool("MAGEFILE_LIST"), "list targets for this binary")
 	fs.BoolVar(&args.Help, "h", parseBool("MAGEFILE_HELP"), "print out help for a specific target")
 	fs.DurationVar(&args.Timeout, "t", parseDuration("MAGEFILE_TIMEOUT"), "timeout in duration parsable format (e.g. 5m30s)")
+	fs.IntVar(&args.Jobs, "j", parseInt("MAGEFILE_JOBS"), "maximum number of dependencies to run in parallel (0 means no limit)")
+	fs.BoolVar(&args.FailFast, "failfast", parseBool("MAGEFILE_FAILFAST"), "cancel the remaining dependencies after the first one fails")
+	fs.StringVar(&args.Trace, "trace", os.Getenv("MAGEFILE_TRACE"), "write a trace of the run to the given file, in Chrome trace format")
+	fs.BoolVar(&args.Timings, "timings", parseBool("MAGEFILE_TIMINGS"), "print how long each target and dependency took after the run")
+	fs.StringVar(&args.Output, "output", os.Getenv("MAGEFILE_OUTPUT"), "how to write the output of commands run by dependencies: raw, prefixed or grouped")
 	fs.Usage = func() {
 		_fmt.Fprintf(os.Stdout, ` + "`" + `
 %s [options] [target]
@@ -86,9 +153,19 @@ Commands:
   -h    show this help
 
 Options:
+  -failfast
+        cancel the remaining dependencies after the first one fails
   -h    show description of a target
+  -j <int>
+        maximum number of dependencies to run in parallel (0 means no limit)
+  -output <string>
+        how to write the output of commands run by dependencies: raw, prefixed or grouped (default "raw")
   -t <string>
         timeout in duration parsable format (e.g. 5m30s)
+  -timings
+        print how long each target and dependency took after the run
+  -trace <string>
+        write a trace of the run to the given file, in Chrome trace format
   -v    show verbose output when running targets
  ` + "`" + `[1:], _filepath.Base(os.Args[0]))
 	}
@@ -97,6 +174,12 @@ Options:
 		return
 	}
 	args.Args = fs.Args()
+	switch args.Output {
+	case "", "raw", "prefixed", "grouped":
+	default:
+		_fmt.Fprintf(os.Stderr, "unknown output mode %q, must be one of raw, prefixed or grouped\n", args.Output)
+		os.Exit(2)
+	}
 	if args.Help && len(args.Args) == 0 {
 		fs.Usage()
 		return
@@ -267,6 +350,9 @@ Options:
 	var ctx context.Context
 	ctxCancel := func(){}
 
+	exitHooks := &_mageExitHooks{}
+	_flag.Var(exitHooks, "mage.exithooks", "registers functions to call when mage exits, used by mg.AtExit")
+
 	// by deferring in a closure, we let the cancel function get replaced
 	// by the getContext function.
 	defer func() {
@@ -280,12 +366,193 @@ Options:
 			} else {
 				ctx, ctxCancel = context.WithCancel(context.Background())
 			}
+			_flag.Var(&_mageTargetContext{ctx}, "mage.targetcontext", "the context of the running target, used by mg.Deps")
 		}
 
 		return ctx, ctxCancel
 	}
 
-	runTarget := func(logger *_log.Logger, fn func(context.Context) error) interface{} {
+	// traceEvent appends an event in the Chrome trace event format to the trace
+	// file. The mg and sh packages append their own events to the same file,
+	// one per line, each followed by a comma.
+	traceEvent := func(event map[string]interface{}) {
+		if args.Trace == "" {
+			return
+		}
+		b, err := _json.Marshal(event)
+		if err != nil {
+			_log.Println("can't encode trace event:", err)
+			return
+		}
+		f, err := os.OpenFile(args.Trace, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			_log.Println("can't write trace event:", err)
+			return
+		}
+		defer f.Close()
+		f.Write(append(b, ",\n"...))
+	}
+
+	// startTrace creates the trace file and points MAGEFILE_TRACE at it, so
+	// that mg and sh record their events in it too. With -timings but without
+	// -trace, the events are recorded in a temporary file that is removed once
+	// the timings are printed. Top level targets are recorded on their own lane,
+	// with a tid of 0, which no goroutine has.
+	//
+	// MAGEFILE_TRACE_OPEN names the file while it is being written, so that a
+	// magefile run by one of our targets, which inherits our environment, adds
+	// its events to our trace instead of starting it over. The timings of such
+	// a nested run are printed by the outermost one, with its own.
+	tempTrace, joinedTrace := false, false
+	startTrace := func() {
+		if open := os.Getenv("MAGEFILE_TRACE_OPEN"); open != "" {
+			path := open
+			if args.Trace != "" {
+				path, _ = _filepath.Abs(args.Trace)
+			}
+			if path == open {
+				args.Trace, joinedTrace = open, true
+				traceEvent(map[string]interface{}{"name": "thread_name", "ph": "M", "pid": os.Getpid(), "tid": 0, "args": map[string]interface{}{"name": "targets"}})
+				return
+			}
+		}
+		if args.Trace == "" && args.Timings {
+			f, err := os.CreateTemp("", "mage-trace-*.json")
+			if err != nil {
+				_log.Println("can't create trace file:", err)
+				return
+			}
+			f.Close()
+			args.Trace, tempTrace = f.Name(), true
+		}
+		if args.Trace == "" {
+			return
+		}
+		path, err := _filepath.Abs(args.Trace)
+		if err == nil {
+			err = os.WriteFile(path, []byte("[\n"), 0o644)
+		}
+		if err != nil {
+			_log.Println("can't create trace file:", err)
+			args.Trace = ""
+			return
+		}
+		args.Trace = path
+		os.Setenv("MAGEFILE_TRACE", path)
+		os.Setenv("MAGEFILE_TRACE_OPEN", path)
+		traceEvent(map[string]interface{}{"name": "thread_name", "ph": "M", "pid": os.Getpid(), "tid": 0, "args": map[string]interface{}{"name": "targets"}})
+	}
+
+	// printTimings prints a table of the targets and dependencies recorded in
+	// the trace file, in the order they started.
+	printTimings := func(path string) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			// -timings was asked for, so say why there are none even
+			// without -v.
+			_fmt.Fprintln(os.Stderr, "warning: can't print timings:", err)
+			return
+		}
+		var events []struct {
+			Name string
+			Cat  string
+			Ph   string
+			Ts   int64
+			Dur  int64
+			Args map[string]interface{}
+		}
+		if err := _json.Unmarshal(b, &events); err != nil {
+			_fmt.Fprintln(os.Stderr, "warning: can't print timings:", err)
+			return
+		}
+		_sort.SliceStable(events, func(i, j int) bool { return events[i].Ts < events[j].Ts })
+		w := _tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+		_fmt.Fprintln(w, "\nNAME\tKIND\tTIME\tSTATUS\tCACHED")
+		for _, e := range events {
+			if e.Cat != "target" && e.Cat != "dep" {
+				continue
+			}
+			d := time.Duration(e.Dur) * time.Microsecond
+			cached := "no"
+			if e.Ph == "i" {
+				// instant events are dependencies that were skipped, or that
+				// had already been run by someone else, in which case the
+				// time is how long the caller waited for them.
+				if e.Args["cached"] == true {
+					cached = "yes"
+				}
+				if us, ok := e.Args["waited_us"].(float64); ok {
+					d = time.Duration(us) * time.Microsecond
+				}
+			}
+			switch {
+			case d >= time.Second:
+				d = d.Round(10 * time.Millisecond)
+			case d >= time.Millisecond:
+				d = d.Round(10 * time.Microsecond)
+			}
+			_fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%s\n", e.Name, e.Cat, d, e.Args["status"], cached)
+		}
+		w.Flush()
+	}
+
+	// finishTrace closes the JSON array of events in the trace file, and
+	// prints the timings if they were asked for. The last event is written
+	// without a trailing comma.
+	finishTrace := func() {
+		if args.Trace == "" {
+			return
+		}
+		path := args.Trace
+		args.Trace = ""
+		process := map[string]interface{}{"name": "process_name", "ph": "M", "pid": os.Getpid(), "tid": 0, "args": map[string]interface{}{"name": "{{.BinaryName}}"}}
+		if joinedTrace {
+			// the outer run closes the array.
+			traceEvent(process)
+			return
+		}
+		b, _ := _json.Marshal(process)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			_log.Println("can't finish trace:", err)
+			return
+		}
+		f.Write(append(b, "\n]\n"...))
+		f.Close()
+		if args.Timings {
+			printTimings(path)
+		}
+		if tempTrace {
+			os.Remove(path)
+		}
+	}
+
+	// traceTarget records a top level target that started at start and
+	// returned err.
+	traceTarget := func(name string, start time.Time, err interface{}) {
+		status := "ok"
+		eventArgs := map[string]interface{}{}
+		if err != nil {
+			status = "failed"
+			if e, ok := err.(error); ok && (e == context.Canceled || e == context.DeadlineExceeded) {
+				status = "cancelled"
+			}
+			eventArgs["error"] = _fmt.Sprint(err)
+		}
+		eventArgs["status"] = status
+		traceEvent(map[string]interface{}{
+			"name": name,
+			"cat":  "target",
+			"ph":   "X",
+			"ts":   start.UnixMicro(),
+			"dur":  time.Since(start).Microseconds(),
+			"pid":  os.Getpid(),
+			"tid":  0,
+			"args": eventArgs,
+		})
+	}
+
+	execTarget := func(logger *_log.Logger, fn func(context.Context) error) interface{} {
 		var err interface{}
 		ctx, cancel := getContext()
 		d := make(chan interface{})
@@ -328,20 +595,92 @@ Options:
 			return err
 		}
 	}
+
+	runTarget := func(logger *_log.Logger, name string, fn func(context.Context) error) interface{} {
+		{{- if or .BeforeTarget .AfterTarget}}
+		// run the target between the hooks declared in the magefiles. The
+		// after hook is only called if the before hook succeeded, and is
+		// called even if the target panics.
+		target := fn
+		fn = func(ctx context.Context) (err error) {
+			{{- if .BeforeTarget}}
+			if err := BeforeTarget(ctx, name); err != nil {
+				return err
+			}
+			{{- end}}
+			{{- if .AfterTarget}}
+			defer func() {
+				if v := recover(); v != nil {
+					err, ok := v.(error)
+					if !ok {
+						err = _fmt.Errorf("%v", v)
+					}
+					AfterTarget(ctx, name, err)
+					panic(v)
+				}
+				AfterTarget(ctx, name, err)
+			}()
+			{{- end}}
+			return target(ctx)
+		}
+		{{- end}}
+		start := time.Now()
+		err := execTarget(logger, fn)
+		traceTarget(name, start, err)
+		return err
+	}
 	// This is necessary in case there aren't any targets, to avoid an unused
 	// variable error.
 	_ = runTarget
 
+	// printStderr prints the end of the stderr of the commands that caused err,
+	// as kept by errors like sh.ExitError, since it has usually scrolled out
+	// of sight by the time the error is printed.
+	var printStderr func(logger *_log.Logger, err interface{}, seen map[string]bool)
+	printStderr = func(logger *_log.Logger, err interface{}, seen map[string]bool) {
+		type stderrTail interface {
+			CommandLine() string
+			StderrTail() string
+		}
+		if e, ok := err.(stderrTail); ok {
+			cmd, tail := e.CommandLine(), e.StderrTail()
+			if tail != "" && !seen[cmd+"\x00"+tail] {
+				seen[cmd+"\x00"+tail] = true
+				logger.Printf("stderr of %s:\n    %s\n", cmd, _strings.ReplaceAll(tail, "\n", "\n    "))
+			}
+			return
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			printStderr(logger, e.Unwrap(), seen)
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				printStderr(logger, err, seen)
+			}
+		}
+	}
+
+	// exit exits once targets may have run, so that what they started is
+	// stopped and the trace is complete.
+	exit := func(code int) {
+		exitHooks.run()
+		finishTrace()
+		os.Exit(code)
+	}
+	_ = exit
+
 	handleError := func(logger *_log.Logger, err interface{}) {
 		if err != nil {
+			// %+v makes errors like mg.DepsError print a detailed report.
 			logger.Printf("Error: %+v\n", err)
+			printStderr(logger, err, map[string]bool{})
 			type code interface {
 				ExitStatus() int
 			}
 			if c, ok := err.(code); ok {
-				os.Exit(c.ExitStatus())
+				exit(c.ExitStatus())
 			}
-			os.Exit(1)
+			exit(1)
 		}
 	}
 	_ = handleError
@@ -353,6 +692,23 @@ Options:
 		os.Setenv("MAGEFILE_VERBOSE", "0")
 	}
 
+	// Set MAGEFILE_JOBS so mg.Jobs() reflects the flag value.
+	if args.Jobs > 0 {
+		os.Setenv("MAGEFILE_JOBS", strconv.Itoa(args.Jobs))
+	} else {
+		os.Setenv("MAGEFILE_JOBS", "0")
+	}
+
+	// Set MAGEFILE_OUTPUT so mg.OutputMode() reflects the flag value.
+	os.Setenv("MAGEFILE_OUTPUT", args.Output)
+
+	// Set MAGEFILE_FAILFAST so mg.FailFast() reflects the flag value.
+	if args.FailFast {
+		os.Setenv("MAGEFILE_FAILFAST", "1")
+	} else {
+		os.Setenv("MAGEFILE_FAILFAST", "0")
+	}
+
 	_log.SetFlags(0)
 	if !args.Verbose {
 		_log.SetOutput(_io.Discard)
@@ -415,13 +771,16 @@ Options:
 				os.Exit(2)
 		}
 	}
+	startTrace()
+	defer finishTrace()
+	defer exitHooks.run()
 	if len(args.Args) < 1 {
 	{{- if .DefaultFunc.Name}}
 		ignoreDefault, _ := strconv.ParseBool(os.Getenv("MAGEFILE_IGNOREDEFAULT"))
 		if ignoreDefault {
 			if err := list(); err != nil {
 				logger.Println("Error:", err)
-				os.Exit(1)
+				exit(1)
 			}
 			return
 		}
@@ -431,7 +790,7 @@ Options:
 	{{- else}}
 		if err := list(); err != nil {
 			logger.Println("Error:", err)
-			os.Exit(1)
+			exit(1)
 		}
 		return
 	{{- end}}
@@ -456,7 +815,7 @@ Options:
 					// note that expected and args at this point include the arg for the target itself
 					// so we subtract 1 here to show the number of args without the target.
 					logger.Printf("not enough arguments for target \"{{.TargetName}}\", expected %v, got %v\n", expected-1, len(args.Args)-1)
-					os.Exit(2)
+					exit(2)
 				}
 				if args.Verbose {
 					logger.Println("Running target:", "{{.TargetName}}")
@@ -473,7 +832,7 @@ Options:
 						// note that expected and args at this point include the arg for the target itself
 						// so we subtract 1 here to show the number of args without the target.
 						logger.Printf("not enough arguments for target \"{{.TargetName}}\", expected %v, got %v\n", expected-1, len(args.Args)-1)
-						os.Exit(2)
+						exit(2)
 					}
 					if args.Verbose {
 						logger.Println("Running target:", "{{.TargetName}}")
@@ -484,7 +843,7 @@ Options:
 		{{- end}}
 		default:
 			logger.Printf("Unknown target specified: %q\n", target)
-			os.Exit(2)
+			exit(2)
 		}
 	}
 }
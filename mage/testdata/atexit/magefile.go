@@ -0,0 +1,29 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+func Build() {
+	mg.AtExit(func() { fmt.Println("first hook") })
+	mg.AtExit(func() { fmt.Println("second hook") })
+	fmt.Println("building")
+}
+
+func Fail() error {
+	mg.AtExit(func() { fmt.Println("cleanup") })
+	return errors.New("failed")
+}
+
+func Greet(name string) {
+	fmt.Println("hello", name)
+}
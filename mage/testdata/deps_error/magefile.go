@@ -0,0 +1,21 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"github.com/actualyze-ai/mage/mg"
+)
+
+var Default = Build
+
+func Build() {
+	mg.SerialDeps(Lint)
+}
+
+func Lint() error {
+	return mg.Fatal(3, "lint failed")
+}
@@ -0,0 +1,33 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"github.com/actualyze-ai/mage/mg"
+)
+
+type Docs mg.Namespace
+
+// Generate generates the docs.
+func (Docs) Generate() {
+	mg.Deps(tools)
+}
+
+// Build builds the binaries.
+func Build() {
+	mg.Deps(Docs.Generate, mg.F(compile, "server"))
+	mg.SerialDeps(tools)
+}
+
+// Lint lints the code.
+func Lint() {}
+
+func compile(name string) {
+	mg.Deps(tools)
+}
+
+func tools() {}
@@ -0,0 +1,37 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func BeforeTarget(ctx context.Context, name string) error {
+	fmt.Println("before", name)
+	if name == "Denied" {
+		return errors.New("denied")
+	}
+	return nil
+}
+
+func AfterTarget(ctx context.Context, name string, err error) {
+	fmt.Printf("after %s: %v\n", name, err)
+}
+
+func Build() {
+	fmt.Println("building")
+}
+
+func Fail() error {
+	return errors.New("failed")
+}
+
+func Denied() {
+	fmt.Println("should not run")
+}
@@ -0,0 +1,34 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"os"
+
+	"github.com/actualyze-ai/mage/mg"
+	"github.com/actualyze-ai/mage/sh"
+)
+
+// Outer runs this magefile again, the way a target might run another tool
+// built with mage.
+func Outer() error {
+	mg.Deps(Prepare)
+	return sh.RunV(os.Args[0], "inner")
+}
+
+func Inner() {
+	mg.Deps(Cleanup)
+}
+
+func Prepare() {}
+
+func Cleanup() {}
+
+// Corrupt overwrites the trace, so that the timings can't be read from it.
+func Corrupt() error {
+	return os.WriteFile(os.Getenv("MAGEFILE_TRACE"), []byte("garbage"), 0o644)
+}
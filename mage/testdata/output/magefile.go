@@ -0,0 +1,24 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"github.com/actualyze-ai/mage/mg"
+	"github.com/actualyze-ai/mage/sh"
+)
+
+func Build() {
+	mg.Deps(GoOS, GoArch)
+}
+
+func GoOS() error {
+	return sh.RunV(mg.GoCmd(), "env", "GOOS")
+}
+
+func GoArch() error {
+	return sh.RunV(mg.GoCmd(), "env", "GOARCH")
+}
@@ -0,0 +1,16 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"github.com/actualyze-ai/mage/mg"
+	"github.com/actualyze-ai/mage/sh"
+)
+
+func Build() error {
+	return sh.Run(mg.GoCmd(), "bogus")
+}
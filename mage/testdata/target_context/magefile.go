@@ -0,0 +1,23 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+func Build() {
+	mg.Deps(Deadline)
+}
+
+func Deadline(ctx context.Context) {
+	_, ok := ctx.Deadline()
+	fmt.Println("deadline:", ok)
+}
@@ -0,0 +1,24 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"github.com/actualyze-ai/mage/mg"
+	"github.com/actualyze-ai/mage/sh"
+)
+
+func Build() {
+	mg.SerialDeps(Generate, Compile)
+}
+
+func Compile() {
+	mg.Deps(Generate)
+}
+
+func Generate() error {
+	return sh.Run(mg.GoCmd(), "version")
+}
@@ -0,0 +1,438 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/actualyze-ai/mage/internal"
+)
+
+// CacheOption configures a function wrapped with Cached.
+type CacheOption func(*cacheSpec)
+
+type cacheSpec struct {
+	inputs  []string
+	outputs []string
+	env     []string
+}
+
+// Inputs declares the files a cached function reads. Patterns are matched like
+// filepath.Glob, except that a "**" path element matches any number of
+// directories, e.g. "**/*.go". A pattern that matches a directory includes
+// every file under it.
+func Inputs(patterns ...string) CacheOption {
+	return func(s *cacheSpec) {
+		s.inputs = append(s.inputs, patterns...)
+	}
+}
+
+// Outputs declares the files or directories a cached function creates. They
+// are copied into the cache after the function succeeds, and restored from it
+// if they are missing or modified when the function is skipped. Outputs are
+// never inputs, even if an Inputs pattern matches them, so a function that
+// writes into the tree it reads isn't out of date after every run.
+func Outputs(paths ...string) CacheOption {
+	return func(s *cacheSpec) {
+		s.outputs = append(s.outputs, paths...)
+	}
+}
+
+// EnvKeys declares the environment variables that affect a cached function,
+// such as GOOS.
+func EnvKeys(keys ...string) CacheOption {
+	return func(s *cacheSpec) {
+		s.env = append(s.env, keys...)
+	}
+}
+
+// Cached wraps a function so that it only runs when its declared inputs or
+// environment variables changed since it last succeeded, even across runs of
+// mage. The function may be anything Deps accepts, and the returned Fn may be
+// passed to Deps or run directly:
+//
+//	func Build(ctx context.Context) error {
+//		return mg.Cached(build,
+//			mg.Inputs("**/*.go", "go.sum"),
+//			mg.Outputs("bin/app"),
+//			mg.EnvKeys("GOOS", "GOARCH"),
+//		).Run(ctx)
+//	}
+//
+// Results are stored under CacheDir, keyed by the working directory and the
+// function, and only hold for the compiled magefile that stored them, so that
+// changing the magefile reruns every cached function. A function declared
+// without Inputs or EnvKeys has nothing to compare, so it runs every time.
+// When run with -v, mage prints why a cached function was skipped or rerun.
+func Cached(fn interface{}, opts ...CacheOption) Fn {
+	c := &cachedFn{fn: checkFns([]interface{}{fn})[0]}
+	for _, opt := range opts {
+		opt(&c.spec)
+	}
+	return c
+}
+
+// cachedFn keeps the name and ID of the function it wraps, so that Deps runs
+// the function once whether or not it is wrapped.
+type cachedFn struct {
+	fn   Fn
+	spec cacheSpec
+}
+
+// Name implements Fn.
+func (c *cachedFn) Name() string {
+	return c.fn.Name()
+}
+
+// ID implements Fn.
+func (c *cachedFn) ID() string {
+	return c.fn.ID()
+}
+
+// cacheManifest is the result of a successful run of a cached function, as
+// stored in the cache.
+type cacheManifest struct {
+	Build   string                `json:"build"`  // digest of the compiled magefile
+	Inputs  map[string]string     `json:"inputs"` // file -> digest
+	Env     map[string]string     `json:"env"`
+	Outputs []string              `json:"outputs"` // as declared
+	Files   map[string]cachedFile `json:"files"`   // output file -> contents
+}
+
+type cachedFile struct {
+	Digest string      `json:"digest"`
+	Mode   fs.FileMode `json:"mode"`
+}
+
+// Run implements Fn. It runs the wrapped function unless the cache holds the
+// result of a run with the same inputs and environment.
+func (c *cachedFn) Run(ctx context.Context) error {
+	name := displayName(c.fn.Name())
+	if len(c.spec.inputs) == 0 && len(c.spec.env) == 0 {
+		if Verbose() {
+			logger.Printf("Running %s: no inputs declared", name)
+		}
+		return c.fn.Run(ctx)
+	}
+	cur, err := c.current()
+	if err != nil {
+		return fmt.Errorf("can't hash inputs of %s: %v", name, err)
+	}
+	dir := filepath.Join(CacheDir(), "results")
+	entry, err := c.entry(dir)
+	if err != nil {
+		return err
+	}
+	prev, err := readManifest(entry)
+	if err != nil && Verbose() {
+		logger.Printf("ignoring cached result of %s: %v", name, err)
+	}
+
+	reason := staleReason(prev, cur)
+	if reason == "" {
+		restored, err := restoreOutputs(dir, prev)
+		if err == nil {
+			if Verbose() {
+				msg := "Skipping " + name + ": inputs unchanged"
+				if len(restored) > 0 {
+					msg += ", restored " + strings.Join(restored, ", ")
+				}
+				logger.Println(msg)
+			}
+			return nil
+		}
+		reason = fmt.Sprintf("can't restore outputs: %v", err)
+	}
+	if Verbose() {
+		logger.Printf("Running %s: %s", name, reason)
+	}
+	if err := c.fn.Run(ctx); err != nil {
+		return err
+	}
+	for _, out := range cur.Outputs {
+		if _, err := os.Stat(out); err != nil {
+			return fmt.Errorf("can't cache outputs of %s: declared output %s: %w", name, out, err)
+		}
+	}
+	// the function succeeded, so a cache that can't be written only costs
+	// the next run.
+	if err := storeOutputs(dir, cur); err != nil {
+		logger.Printf("warning: can't cache outputs of %s: %v", name, err)
+		return nil
+	}
+	if err := writeManifest(entry, cur); err != nil {
+		logger.Printf("warning: can't cache result of %s: %v", name, err)
+	}
+	return nil
+}
+
+// entry returns the path of the manifest for the function, which depends on
+// the working directory, so that different checkouts don't share results.
+func (c *cachedFn) entry(dir string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", wd, c.fn.Name(), c.fn.ID())
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json"), nil
+}
+
+// current returns the manifest for the current state of the inputs and
+// environment. Its files are filled in by storeOutputs.
+func (c *cachedFn) current() (*cacheManifest, error) {
+	build, err := buildDigest()
+	if err != nil {
+		return nil, err
+	}
+	m := &cacheManifest{
+		Build:   build,
+		Inputs:  map[string]string{},
+		Env:     map[string]string{},
+		Outputs: c.spec.outputs,
+		Files:   map[string]cachedFile{},
+	}
+	for _, pattern := range c.spec.inputs {
+		matches, err := internal.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if err := hashFiles(match, func(name string, f cachedFile) {
+				if !c.isOutput(name) {
+					m.Inputs[filepath.ToSlash(name)] = f.Digest
+				}
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, key := range c.spec.env {
+		if v, ok := os.LookupEnv(key); ok {
+			m.Env[key] = v
+		}
+	}
+	return m, nil
+}
+
+// buildDigest returns the digest of the running executable, which is the
+// compiled magefile.
+var buildDigest = sync.OnceValues(func() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return hashFile(exe)
+})
+
+// isOutput reports whether the file name is, or is under, a declared output.
+func (c *cachedFn) isOutput(name string) bool {
+	name = filepath.Clean(name)
+	for _, out := range c.spec.outputs {
+		out = filepath.Clean(out)
+		if name == out || strings.HasPrefix(name, out+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleReason explains why the function has to run again, or returns "" if
+// the previous result is still valid.
+func staleReason(prev, cur *cacheManifest) string {
+	if prev == nil {
+		return "no cached result"
+	}
+	if prev.Build != cur.Build {
+		return "magefile changed"
+	}
+	if changed := diffKeys(prev.Inputs, cur.Inputs); len(changed) > 0 {
+		return "inputs changed: " + summarize(changed)
+	}
+	if changed := diffKeys(prev.Env, cur.Env); len(changed) > 0 {
+		return "environment changed: " + summarize(changed)
+	}
+	if strings.Join(prev.Outputs, "\x00") != strings.Join(cur.Outputs, "\x00") {
+		return "outputs changed"
+	}
+	return ""
+}
+
+// diffKeys returns the sorted keys whose values differ between a and b.
+func diffKeys(a, b map[string]string) []string {
+	var keys []string
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// summarize lists the first few names, and how many more there are.
+func summarize(names []string) string {
+	const max = 3
+	if len(names) <= max {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:max], ", "), len(names)-max)
+}
+
+// storeOutputs copies the declared outputs into the cache, and records them in
+// the manifest. Files are stored by digest, so identical outputs of different
+// functions share storage.
+func storeOutputs(dir string, m *cacheManifest) error {
+	blobs := filepath.Join(dir, "blobs")
+	if err := os.MkdirAll(blobs, 0o755); err != nil {
+		return err
+	}
+	for _, out := range m.Outputs {
+		err := hashFiles(out, func(name string, f cachedFile) {
+			m.Files[filepath.ToSlash(name)] = f
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name, f := range m.Files {
+		blob := filepath.Join(blobs, f.Digest)
+		if _, err := os.Stat(blob); err == nil {
+			continue
+		}
+		if err := copyFile(blob, filepath.FromSlash(name), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreOutputs puts back the cached outputs that are missing or were
+// modified, and returns their names.
+func restoreOutputs(dir string, m *cacheManifest) ([]string, error) {
+	var names []string
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var restored []string
+	for _, name := range names {
+		f := m.Files[name]
+		path := filepath.FromSlash(name)
+		if digest, err := hashFile(path); err == nil && digest == f.Digest {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return restored, err
+		}
+		if err := copyFile(path, filepath.Join(dir, "blobs", f.Digest), f.Mode); err != nil {
+			return restored, err
+		}
+		restored = append(restored, name)
+	}
+	return restored, nil
+}
+
+func readManifest(path string) (*cacheManifest, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &cacheManifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func writeManifest(path string, m *cacheManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// hashFiles calls fn with the digest and mode of root, or of every file under
+// root if it is a directory.
+func hashFiles(root string, fn func(name string, f cachedFile)) error {
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		digest, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+		fn(name, cachedFile{Digest: digest, Mode: info.Mode().Perm()})
+		return nil
+	})
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies src to dst through a temporary file, so that dst is never
+// left half written.
+func copyFile(dst, src string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
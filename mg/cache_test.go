@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCached(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Setenv(VerboseEnv, "1")
+	t.Setenv("MAGE_TEST_CACHED", "a")
+	t.Chdir(t.TempDir())
+
+	buf := &bytes.Buffer{}
+	defer func(l *log.Logger) { logger = l }(logger)
+	logger = log.New(buf, "", 0)
+
+	if err := os.MkdirAll("src/pkg", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("src/main.go", "package main")
+	write("src/pkg/pkg.go", "package pkg")
+
+	runs := 0
+	build := func() error {
+		runs++
+		if err := os.MkdirAll("bin", 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile("bin/app", []byte("app"), 0o755)
+	}
+	run := func(wantRuns int, wantLog string) {
+		t.Helper()
+		buf.Reset()
+		fn := Cached(build, Inputs("src/**/*.go"), Outputs("bin"), EnvKeys("MAGE_TEST_CACHED"))
+		if err := fn.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if runs != wantRuns {
+			t.Fatalf("expected %d runs, got %d", wantRuns, runs)
+		}
+		if !strings.Contains(buf.String(), wantLog) {
+			t.Fatalf("expected log to contain %q, got %q", wantLog, buf.String())
+		}
+	}
+
+	run(1, "no cached result")
+	run(1, "inputs unchanged")
+
+	write("src/pkg/pkg.go", "package pkg // changed")
+	run(2, "inputs changed: src/pkg/pkg.go")
+
+	t.Setenv("MAGE_TEST_CACHED", "b")
+	run(3, "environment changed: MAGE_TEST_CACHED")
+
+	if err := os.RemoveAll("bin"); err != nil {
+		t.Fatal(err)
+	}
+	run(3, "inputs unchanged, restored bin/app")
+	b, err := os.ReadFile(filepath.Join("bin", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "app" {
+		t.Fatalf("expected restored output to be %q, got %q", "app", b)
+	}
+	if info, err := os.Stat("bin/app"); err != nil || info.Mode().Perm() != 0o755 {
+		t.Fatalf("expected restored output to be executable, got %v, %v", info.Mode(), err)
+	}
+}
+
+func TestCachedOutputsUnderInputs(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	if err := os.WriteFile("main.go", []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	generate := func() error {
+		runs++
+		if err := os.MkdirAll("gen", 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile("gen/version.go", []byte(fmt.Sprintf("package gen // run %d", runs)), 0o644)
+	}
+	for i := 0; i < 3; i++ {
+		fn := Cached(generate, Inputs("**/*"), Outputs("gen"))
+		if err := fn.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("expected outputs under the inputs not to make the function stale, got %d runs", runs)
+	}
+}
+
+func TestCachedMagefileChanged(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	runs := 0
+	fn := func() { runs++ }
+	run := func() {
+		t.Helper()
+		if err := Cached(fn, EnvKeys("MAGE_TEST_CACHED")).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run()
+	run()
+	if runs != 1 {
+		t.Fatalf("expected the second run to be skipped, got %d runs", runs)
+	}
+
+	// results stored by another build of the magefile don't hold.
+	entries, err := filepath.Glob(filepath.Join(CacheDir(), "results", "*.json"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one cached result, got %q, %v", entries, err)
+	}
+	m, err := readManifest(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Build = "other"
+	if err := writeManifest(entries[0], m); err != nil {
+		t.Fatal(err)
+	}
+	run()
+	if runs != 2 {
+		t.Fatalf("expected a changed magefile to rerun the function, got %d runs", runs)
+	}
+}
+
+func TestCachedNoInputs(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	runs := 0
+	fn := func() { runs++ }
+	for i := 1; i <= 2; i++ {
+		if err := Cached(fn).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if runs != i {
+			t.Fatalf("expected a function without inputs to run every time, got %d runs", runs)
+		}
+	}
+}
+
+func TestCachedUnwritable(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	buf := &bytes.Buffer{}
+	defer func(l *log.Logger) { logger = l }(logger)
+	logger = log.New(buf, "", 0)
+
+	// the blobs can't be stored where a file is in the way.
+	if err := os.MkdirAll(filepath.Join(CacheDir(), "results"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(CacheDir(), "results", "blobs"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("out", []byte("out"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	fn := func() { runs++ }
+	for i := 1; i <= 2; i++ {
+		if err := Cached(fn, EnvKeys("MAGE_TEST_CACHED"), Outputs("out")).Run(context.Background()); err != nil {
+			t.Fatalf("expected a cache error not to fail the function, got %v", err)
+		}
+		if runs != i {
+			t.Fatalf("expected a result that couldn't be cached to be rerun, got %d runs", runs)
+		}
+	}
+	if !strings.Contains(buf.String(), "warning: can't cache outputs of") {
+		t.Fatalf("expected a warning, got %q", buf.String())
+	}
+}
+
+func TestCachedFailure(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	runs := 0
+	fail := func() error {
+		runs++
+		return Fatal(2, "boom")
+	}
+	for i := 1; i <= 2; i++ {
+		err := Cached(fail).Run(context.Background())
+		if ExitStatus(err) != 2 {
+			t.Fatalf("expected exit status 2, got %v", err)
+		}
+		if runs != i {
+			t.Fatalf("expected a failed run not to be cached, got %d runs", runs)
+		}
+	}
+}
+
+func TestCachedMissingOutput(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	err := Cached(func() {}, EnvKeys("MAGE_TEST_CACHED"), Outputs("missing")).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "declared output missing") {
+		t.Fatalf("expected an error about the missing output, got %v", err)
+	}
+}
+
+func TestCachedDeps(t *testing.T) {
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Chdir(t.TempDir())
+
+	runs := 0
+	fn := func() { runs++ }
+	Deps(Cached(fn), fn)
+	if runs != 1 {
+		t.Fatalf("expected a cached function and the function itself to run once, got %d runs", runs)
+	}
+}
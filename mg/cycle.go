@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/actualyze-ai/mage/internal"
+)
+
+// depGraph tracks the dependencies that are currently running and the
+// dependencies each of them is waiting on. Because every dependency runs
+// exactly once, a running dependency that (directly or transitively) waits on
+// itself can never finish, so the graph is used to turn that deadlock into an
+// error.
+type depGraph struct {
+	mu *sync.Mutex
+
+	// running holds, per goroutine, the stack of dependencies being run by
+	// that goroutine. Dependencies run in the calling goroutine (see runDeps)
+	// are pushed on top of the dependency that called them.
+	running map[uint64][]*onceFun
+
+	// waits holds the dependencies each running dependency is waiting on.
+	waits map[*onceFun][]*onceFun
+}
+
+var graph = &depGraph{
+	mu:      &sync.Mutex{},
+	running: map[uint64][]*onceFun{},
+	waits:   map[*onceFun][]*onceFun{},
+}
+
+// current returns the dependency being run by the calling goroutine, or nil if
+// it isn't running one (e.g. it is a top level target).
+func (g *depGraph) current() *onceFun {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stack := g.running[internal.Goid()]
+	if len(stack) == 0 {
+		return nil
+	}
+	return stack[len(stack)-1]
+}
+
+// enter records that the calling goroutine has started running o.
+func (g *depGraph) enter(o *onceFun) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := internal.Goid()
+	g.running[id] = append(g.running[id], o)
+}
+
+// leave records that the calling goroutine has finished running o.
+func (g *depGraph) leave(o *onceFun) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := internal.Goid()
+	stack := g.running[id]
+	if len(stack) > 0 && stack[len(stack)-1] == o {
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) == 0 {
+		delete(g.running, id)
+		return
+	}
+	g.running[id] = stack
+}
+
+// wait records that parent is waiting on dep. If dep already (transitively)
+// waits on parent, the edge is not recorded and the cycle is returned instead,
+// starting and ending with dep.
+func (g *depGraph) wait(parent, dep *onceFun) []*onceFun {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if path := g.path(dep, parent, map[*onceFun]bool{}); path != nil {
+		return append(path, dep)
+	}
+	g.waits[parent] = append(g.waits[parent], dep)
+	return nil
+}
+
+// done records that parent is no longer waiting on deps.
+func (g *depGraph) done(parent *onceFun, deps []*onceFun) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	waits := g.waits[parent]
+	for _, dep := range deps {
+		for i := range waits {
+			if waits[i] == dep {
+				waits = append(waits[:i], waits[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(waits) == 0 {
+		delete(g.waits, parent)
+		return
+	}
+	g.waits[parent] = waits
+}
+
+// path returns the chain of waits leading from "from" to "to", or nil if there
+// is none.
+func (g *depGraph) path(from, to *onceFun, seen map[*onceFun]bool) []*onceFun {
+	if from == to {
+		return []*onceFun{from}
+	}
+	if seen[from] {
+		return nil
+	}
+	seen[from] = true
+	for _, next := range g.waits[from] {
+		if rest := g.path(next, to, seen); rest != nil {
+			return append([]*onceFun{from}, rest...)
+		}
+	}
+	return nil
+}
+
+// cyclePath formats a dependency cycle as "A -> B -> A".
+func cyclePath(cycle []*onceFun) string {
+	names := make([]string, len(cycle))
+	for i, o := range cycle {
+		names[i] = o.String()
+	}
+	return strings.Join(names, " -> ")
+}
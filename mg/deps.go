@@ -8,13 +8,19 @@ package mg
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/actualyze-ai/mage/internal"
 )
 
 var logger = log.New(os.Stderr, "", 0)
@@ -55,14 +61,52 @@ var onces = &onceMap{
 	m:  map[onceKey]*onceFun{},
 }
 
+// jobSlots limits how many dependencies run in their own goroutine at the same
+// time. All calls to Deps and its variants share the same slots.
+type jobSlots struct {
+	once  *sync.Once
+	slots chan struct{}
+}
+
+// tryAcquire reports whether the caller may start a dependency in a new
+// goroutine. It never blocks. When every slot is taken, the caller is expected
+// to run the dependency itself, which means the calling goroutine always counts
+// as one of the jobs and a parent waiting on its children can never starve them
+// of slots.
+func (j *jobSlots) tryAcquire() bool {
+	j.once.Do(func() {
+		if n := Jobs(); n > 0 {
+			j.slots = make(chan struct{}, n-1)
+		}
+	})
+	if j.slots == nil {
+		return true
+	}
+	select {
+	case j.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by a successful call to tryAcquire.
+func (j *jobSlots) release() {
+	if j.slots != nil {
+		<-j.slots
+	}
+}
+
+var jobs = &jobSlots{once: &sync.Once{}}
+
 // SerialDeps is like Deps except it runs each dependency serially, instead of
 // in parallel. This can be useful for resource intensive dependencies that
 // shouldn't be run at the same time.
 func SerialDeps(fns ...interface{}) {
 	funcs := checkFns(fns)
-	ctx := context.Background()
+	ctx := depsContext()
 	for i := range fns {
-		runDeps(ctx, funcs[i:i+1])
+		runDeps(ctx, funcs[i:i+1], true)
 	}
 }
 
@@ -72,7 +116,7 @@ func SerialDeps(fns ...interface{}) {
 func SerialCtxDeps(ctx context.Context, fns ...interface{}) {
 	funcs := checkFns(fns)
 	for i := range fns {
-		runDeps(ctx, funcs[i:i+1])
+		runDeps(ctx, funcs[i:i+1], false)
 	}
 }
 
@@ -90,51 +134,173 @@ func SerialCtxDeps(ctx context.Context, fns ...interface{}) {
 // The function calling Deps is guaranteed that all dependent functions will be
 // run exactly once when Deps returns.  Dependent functions may in turn declare
 // their own dependencies using Deps. Each dependency is run in their own
-// goroutines. Each function is given the context provided if the function
-// prototype allows for it.
+// goroutines, up to the limit reported by Jobs. Each function is given the
+// context provided if the function prototype allows for it.
 func CtxDeps(ctx context.Context, fns ...interface{}) {
 	funcs := checkFns(fns)
-	runDeps(ctx, funcs)
+	runDeps(ctx, funcs, false)
+}
+
+// targetContextFlag is the name of the flag the compiled magefile registers in
+// flag.CommandLine to make the context of the running target available. The
+// generated code only imports the standard library, so it can't hand the
+// context to this package directly. The flag's value implements flag.Getter,
+// and Get returns the context.
+const targetContextFlag = "mage.targetcontext"
+
+// Context returns the context of the dependency being run by the calling
+// goroutine, if any, or else the context of the target being run. It lets code
+// that isn't given a context, such as the sh package, find out whether it has
+// been cancelled, and which dependency it runs under (see DepName).
+func Context() context.Context {
+	if o := graph.current(); o != nil && o.ctx != nil {
+		return context.WithValue(o.ctx, depKey{}, o.state)
+	}
+	return depsContext()
 }
 
-// runDeps assumes you've already called checkFns.
-func runDeps(ctx context.Context, fns []Fn) {
+// depsContext returns the context Deps and SerialDeps pass to dependencies:
+// the context of the dependency being run by the calling goroutine, if any, or
+// else the context of the target being run.
+func depsContext() context.Context {
+	if o := graph.current(); o != nil && o.ctx != nil {
+		return o.ctx
+	}
+	if f := flag.Lookup(targetContextFlag); f != nil {
+		if g, ok := f.Value.(flag.Getter); ok {
+			if ctx, ok := g.Get().(context.Context); ok && ctx != nil {
+				return ctx
+			}
+		}
+	}
+	return context.Background()
+}
+
+// runDeps assumes you've already called checkFns. Each dependency is run in its
+// own goroutine unless the job limit set by Jobs has been reached, in which case
+// it is run in the calling goroutine. If the context was inherited rather than
+// passed in explicitly, dependencies that haven't started when it is done are
+// skipped.
+func runDeps(ctx context.Context, fns []Fn, inherited bool) {
 	mu := &sync.Mutex{}
-	var errs []string
-	var exit int
+	var failed, cancelled []DepFailure
+
+	failFast := FailFast()
+	cancel := func(error) {}
+	if failFast {
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+	}
+
+	// fail records the failure of a dependency. In fail fast mode, the first
+	// failure cancels the remaining dependencies, and failures reported after
+	// that are recorded as cancellations rather than failures in their own
+	// right.
+	fail := func(fn *onceFun, f DepFailure) {
+		mu.Lock()
+		defer mu.Unlock()
+		f.Name = fn.String()
+		if f.Cancelled {
+			cancelled = append(cancelled, f)
+			return
+		}
+		if failFast {
+			var cause *depFailedError
+			if errors.As(context.Cause(ctx), &cause) && cause.fn != fn {
+				f.Err = cause
+				f.Cancelled = true
+				cancelled = append(cancelled, f)
+				return
+			}
+			cancel(&depFailedError{fn: fn, err: f.Err})
+		}
+		failed = append(failed, f)
+	}
+
 	wg := &sync.WaitGroup{}
+	parent := graph.current()
+	var waiting []*onceFun
 	for _, f := range fns {
 		fn := onces.LoadOrStore(f)
+		if parent != nil {
+			if cycle := graph.wait(parent, fn); cycle != nil {
+				fail(fn, DepFailure{Err: Fatalf(1, "dependency cycle detected: %s", cyclePath(cycle)), Code: 1})
+				continue
+			}
+			waiting = append(waiting, fn)
+		}
 		wg.Add(1)
-		go func() {
+		run := func() {
 			defer func() {
 				if v := recover(); v != nil {
-					mu.Lock()
-					if err, ok := v.(error); ok {
-						exit = changeExit(exit, ExitStatus(err))
-					} else {
-						exit = changeExit(exit, 1)
-					}
-					errs = append(errs, fmt.Sprint(v))
-					mu.Unlock()
+					fail(fn, panicFailure(v))
 				}
 				wg.Done()
 			}()
-			if err := fn.run(ctx); err != nil {
-				mu.Lock()
-				errs = append(errs, fmt.Sprint(err))
-				exit = changeExit(exit, ExitStatus(err))
-				mu.Unlock()
+			if ctx.Err() != nil && (failFast || inherited) {
+				// don't start dependencies once a sibling has failed, or
+				// once the target has been cancelled or timed out.
+				internal.TraceInstant("dep", fn.String(), map[string]interface{}{"status": "skipped"})
+				var cause *depFailedError
+				if !inherited && !errors.As(context.Cause(ctx), &cause) {
+					fail(fn, DepFailure{Err: context.Cause(ctx), Code: 1})
+					return
+				}
+				fail(fn, DepFailure{Err: context.Cause(ctx), Code: 1, Cancelled: true})
+				return
 			}
+			if err := fn.run(ctx, parent); err != nil {
+				fail(fn, DepFailure{Err: err, Code: ExitStatus(err)})
+			}
+		}
+		if !jobs.tryAcquire() {
+			run()
+			continue
+		}
+		go func() {
+			defer jobs.release()
+			run()
 		}()
 	}
 
 	wg.Wait()
-	if len(errs) > 0 {
-		panic(Fatal(exit, strings.Join(errs, "\n")))
+	if parent != nil {
+		graph.done(parent, waiting)
+	}
+	if len(failed) > 0 || len(cancelled) > 0 {
+		panic(&DepsError{Failures: append(failed, cancelled...)})
 	}
 }
 
+// panicFailure converts a value recovered from a dependency into a failure. A
+// DepsError means the dependency's own dependencies failed, which isn't a
+// panic as far as the user is concerned, so no stack trace is kept for it.
+func panicFailure(v interface{}) DepFailure {
+	if err, ok := v.(*DepsError); ok {
+		return DepFailure{Err: err, Code: err.ExitStatus()}
+	}
+	err, ok := v.(error)
+	if !ok {
+		err = errors.New(fmt.Sprint(v))
+	}
+	return DepFailure{Err: err, Code: ExitStatus(err), Stack: debug.Stack()}
+}
+
+// depFailedError is the cause given to the context of a Deps call that was
+// cancelled in fail fast mode.
+type depFailedError struct {
+	fn  *onceFun
+	err error
+}
+
+func (e *depFailedError) Error() string {
+	return fmt.Sprintf("dependency %s failed: %v", e.fn, e.err)
+}
+
+func (e *depFailedError) Unwrap() error {
+	return e.err
+}
+
 func checkFns(fns []interface{}) []Fn {
 	funcs := make([]Fn, len(fns))
 	for i, f := range fns {
@@ -168,8 +334,14 @@ func checkFns(fns []interface{}) []Fn {
 // This is a way to build up a tree of dependencies with each dependency
 // defining its own dependencies.  Functions must have the same signature as a
 // Mage target, i.e. optional context argument, optional error return.
+//
+// Dependencies that take a context are given the context of the dependency
+// that called Deps, or of the target being run, so they see its timeout and
+// cancellation. Dependencies that haven't started by the time that context is
+// done are skipped.
 func Deps(fns ...interface{}) {
-	CtxDeps(context.Background(), fns...)
+	funcs := checkFns(fns)
+	runDeps(depsContext(), funcs, true)
 }
 
 func changeExit(old, new int) int {
@@ -201,21 +373,83 @@ func displayName(name string) string {
 }
 
 type onceFun struct {
-	once *sync.Once
-	fn   Fn
-	err  error
+	once  *sync.Once
+	fn    Fn
+	err   error
+	ctx   context.Context // the context fn was run with
+	state *depState       // see Context
 
 	displayName string
 }
 
+// String returns the display name of the function, followed by its arguments if
+// it was wrapped with mg.F.
+func (o *onceFun) String() string {
+	id := o.fn.ID()
+	if !strings.HasPrefix(id, "[") || id == "[]" {
+		return o.displayName
+	}
+	return o.displayName + "(" + strings.TrimSuffix(strings.TrimPrefix(id, "["), "]") + ")"
+}
+
 // run will run the function exactly once and capture the error output. Further runs simply return
-// the same error output.
-func (o *onceFun) run(ctx context.Context) error {
+// the same error output. The caller is the dependency that asked for o to be
+// run, or nil for a top level target, and is only used for tracing.
+func (o *onceFun) run(ctx context.Context, caller *onceFun) error {
+	ran := false
+	start := time.Now()
 	o.once.Do(func() {
+		ran = true
+		o.ctx = ctx
+		o.state = &depState{name: o.String()}
+		graph.enter(o)
+		defer graph.leave(o)
+		defer o.state.flush()
 		if Verbose() {
 			logger.Println("Running dependency:", displayName(o.fn.Name()))
 		}
-		o.err = o.fn.Run(ctx)
+		end := internal.TraceSpan("dep", o.String())
+		status := "failed" // if Run panics
+		defer func() {
+			end(status, traceArgs(caller, o.err))
+		}()
+		o.err = o.runHooked(ctx)
+		status = depStatus(ctx, o.err)
 	})
+	if !ran && internal.Tracing() {
+		// the dependency was run (or is being run) by someone else, record
+		// that we got its result and how long we waited for it.
+		args := traceArgs(caller, o.err)
+		args["status"] = depStatus(ctx, o.err)
+		args["cached"] = true
+		args["waited_us"] = time.Since(start).Microseconds()
+		internal.TraceInstant("dep", o.String(), args)
+	}
 	return o.err
 }
+
+// depStatus returns the outcome of a dependency that returned err, as recorded
+// in the trace.
+func depStatus(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case ctx.Err() != nil:
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// traceArgs returns the args of a trace event for a dependency called by
+// caller that returned err.
+func traceArgs(caller *onceFun, err error) map[string]interface{} {
+	args := map[string]interface{}{}
+	if caller != nil {
+		args["caller"] = caller.String()
+	}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	return args
+}
@@ -12,7 +12,10 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDepsLogging(t *testing.T) {
@@ -60,3 +63,48 @@ func TestDepWasNotInvoked(t *testing.T) {
 		checkFns(fns)
 	}(fn1())
 }
+
+func TestDepsJobLimit(t *testing.T) {
+	defaultJobs := jobs
+	jobs = &jobSlots{once: &sync.Once{}}
+	defer func() { jobs = defaultJobs }()
+	os.Setenv(JobsEnv, "2")
+	defer os.Unsetenv(JobsEnv)
+
+	var running, maxRunning int64
+	work := func() {
+		cur := atomic.AddInt64(&running, 1)
+		for {
+			old := atomic.LoadInt64(&maxRunning)
+			if cur <= old || atomic.CompareAndSwapInt64(&maxRunning, old, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&running, -1)
+	}
+	leaf := func(n int) error {
+		work()
+		return nil
+	}
+	// each parent waits on its own children while holding a slot, which must
+	// not deadlock.
+	parent := func(n int) error {
+		Deps(F(leaf, n*10), F(leaf, n*10+1), F(leaf, n*10+2))
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Deps(F(parent, 1), F(parent, 2), F(parent, 3), F(parent, 4))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deps with a job limit deadlocked")
+	}
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 dependencies to run at once, but got %d", maxRunning)
+	}
+}
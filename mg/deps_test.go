@@ -7,8 +7,13 @@
 package mg
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -202,3 +207,221 @@ func TestDepsErrors(t *testing.T) {
 	}()
 	f()
 }
+
+func cycleA() { Deps(cycleB) }
+
+func cycleB() { Deps(cycleA) }
+
+type cycleNS Namespace
+
+func (cycleNS) A() { Deps(cycleNS.B) }
+
+func (cycleNS) B() { Deps(cycleNS.A) }
+
+func cycleSelf(n int) { Deps(F(cycleSelf, n)) }
+
+func TestDepsCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   interface{}
+		want string
+	}{
+		{"funcs", cycleA, "dependency cycle detected: github.com/actualyze-ai/mage/mg.cycleA -> github.com/actualyze-ai/mage/mg.cycleB -> github.com/actualyze-ai/mage/mg.cycleA"},
+		{"namespace", cycleNS.A, "dependency cycle detected: github.com/actualyze-ai/mage/mg.cycleNS.A -> github.com/actualyze-ai/mage/mg.cycleNS.B -> github.com/actualyze-ai/mage/mg.cycleNS.A"},
+		{"args", F(cycleSelf, 1), "dependency cycle detected: github.com/actualyze-ai/mage/mg.cycleSelf(1) -> github.com/actualyze-ai/mage/mg.cycleSelf(1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan interface{})
+			go func() {
+				defer func() { done <- recover() }()
+				Deps(tt.fn)
+			}()
+			var v interface{}
+			select {
+			case v = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("dependency cycle deadlocked")
+			}
+			if v == nil {
+				t.Fatal("expected panic, but didn't get one")
+			}
+			got := strings.Split(fmt.Sprint(v), "\n")[0]
+			if got != tt.want {
+				t.Fatalf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDepsFailFast(t *testing.T) {
+	os.Setenv(FailFastEnv, "1")
+	defer os.Unsetenv(FailFastEnv)
+
+	lint := func() error {
+		return Fatal(3, "lint failed")
+	}
+	integration := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+	start := time.Now()
+	defer func() {
+		v := recover()
+		if v == nil {
+			t.Fatal("expected panic, but didn't get one")
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("expected the sibling to be cancelled, but Deps took %v", d)
+		}
+		lines := strings.Split(fmt.Sprint(v), "\n")
+		if len(lines) != 2 || lines[0] != "lint failed" || !strings.Contains(lines[1], "was cancelled because") {
+			t.Fatalf("expected the failure followed by the cancellation, but got %q", lines)
+		}
+		if code := ExitStatus(v.(error)); code != 3 {
+			t.Fatalf("expected exit status 3, but got %v", code)
+		}
+	}()
+	Deps(lint, integration)
+}
+
+func TestDepsFailFastSkipsQueued(t *testing.T) {
+	os.Setenv(FailFastEnv, "1")
+	defer os.Unsetenv(FailFastEnv)
+	defaultJobs := jobs
+	jobs = &jobSlots{once: &sync.Once{}}
+	defer func() { jobs = defaultJobs }()
+	os.Setenv(JobsEnv, "1")
+	defer os.Unsetenv(JobsEnv)
+
+	var ran int64
+	first := func() error {
+		return errors.New("first failed")
+	}
+	second := func() {
+		atomic.AddInt64(&ran, 1)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic, but didn't get one")
+		}
+		if ran != 0 {
+			t.Fatal("expected queued dependency not to run after a failure")
+		}
+	}()
+	Deps(first, second)
+}
+
+func TestDepsErrorValues(t *testing.T) {
+	errOuch := errors.New("ouch")
+	f := func() error {
+		return errOuch
+	}
+	g := func() {
+		panic("bang")
+	}
+	defer func() {
+		v := recover()
+		err, ok := v.(*DepsError)
+		if !ok {
+			t.Fatalf("expected *DepsError but got %T", v)
+		}
+		if !errors.Is(err, errOuch) {
+			t.Error("expected errors.Is to find the dependency's error")
+		}
+		if len(err.Failures) != 2 {
+			t.Fatalf("expected 2 failures but got %d", len(err.Failures))
+		}
+		var panicked DepFailure
+		for _, f := range err.Failures {
+			if f.Stack != nil {
+				panicked = f
+			}
+		}
+		if panicked.Err == nil || panicked.Err.Error() != "bang" {
+			t.Fatalf("expected the panic to be recorded with its stack, but got %+v", err.Failures)
+		}
+		if code := ExitStatus(err); code != 1 {
+			t.Errorf("expected exit status 1, but got %v", code)
+		}
+		detail := fmt.Sprintf("%+v", err)
+		if !strings.HasPrefix(detail, "2 dependencies failed:") || !strings.Contains(detail, ": panic: bang\n") {
+			t.Errorf("unexpected detailed output:\n%s", detail)
+		}
+	}()
+	Deps(f, g)
+}
+
+// testTargetContext stands in for the flag the compiled magefile registers to
+// make the context of the running target available.
+type testTargetContext struct {
+	ctx context.Context
+}
+
+func (c *testTargetContext) String() string   { return "" }
+func (c *testTargetContext) Set(string) error { return nil }
+func (c *testTargetContext) Get() interface{} { return c.ctx }
+
+var targetContext = &testTargetContext{}
+
+func init() {
+	flag.Var(targetContext, targetContextFlag, "")
+}
+
+func TestDepsTargetContext(t *testing.T) {
+	type key struct{}
+	targetContext.ctx = context.WithValue(context.Background(), key{}, "target")
+	defer func() { targetContext.ctx = nil }()
+
+	var got, nested interface{}
+	inner := func(ctx context.Context) {
+		nested = ctx.Value(key{})
+	}
+	outer := func(ctx context.Context) {
+		got = ctx.Value(key{})
+		SerialDeps(inner)
+	}
+	Deps(outer)
+	if got != "target" {
+		t.Errorf("expected dependency to get the target's context, got value %v", got)
+	}
+	if nested != "target" {
+		t.Errorf("expected nested dependency to get the target's context, got value %v", nested)
+	}
+}
+
+func TestDepsTargetContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	targetContext.ctx = ctx
+	defer func() { targetContext.ctx = nil }()
+
+	ran := false
+	f := func() { ran = true }
+	func() {
+		defer func() {
+			var err *DepsError
+			if !errors.As(recover().(error), &err) {
+				t.Fatal("expected Deps to panic with a DepsError")
+			}
+			if len(err.Failures) != 1 || !err.Failures[0].Cancelled || !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected the dependency to be cancelled, got %#v", err.Failures)
+			}
+		}()
+		Deps(f)
+	}()
+	if ran {
+		t.Fatal("expected the dependency to be skipped once the target's context is done")
+	}
+
+	// an explicit context is used as is.
+	g := func() { ran = true }
+	CtxDeps(ctx, g)
+	if !ran {
+		t.Fatal("expected CtxDeps to run the dependency")
+	}
+}
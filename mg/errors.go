@@ -9,6 +9,8 @@ package mg
 import (
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 )
 
 type fatalErr struct {
@@ -56,3 +58,117 @@ func ExitStatus(err error) int {
 	}
 	return exit.ExitStatus()
 }
+
+// DepFailure describes a single dependency that failed during a call to Deps
+// or one of its variants.
+type DepFailure struct {
+	// Name is the display name of the dependency, including its arguments if
+	// it was wrapped with mg.F.
+	Name string
+
+	// Err is the error returned by the dependency. If the dependency panicked,
+	// it is the recovered value, converted to an error if necessary. If the
+	// dependency was cancelled, it is the failure of the sibling that caused
+	// the cancellation.
+	Err error
+
+	// Stack is the stack trace of the dependency if it panicked, and nil
+	// otherwise.
+	Stack []byte
+
+	// Code is the exit code mage would exit with for this failure.
+	Code int
+
+	// Cancelled reports whether the dependency was cancelled in fail fast mode
+	// because a sibling failed, or skipped because the context it inherited
+	// was done, rather than failing on its own.
+	Cancelled bool
+}
+
+// DepsError is the error Deps and its variants panic with when any of the
+// dependencies fail. It keeps the original error of every failed dependency,
+// so errors.Is and errors.As can be used to inspect them. Formatting a
+// DepsError with %+v prints each failure on its own line, along with stack
+// traces for dependencies that panicked.
+type DepsError struct {
+	Failures []DepFailure
+}
+
+// Error returns the error messages of the failed dependencies, one per line.
+func (e *DepsError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.message()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors of the failed dependencies.
+func (e *DepsError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// ExitStatus returns the exit code shared by the failed dependencies, or 1 if
+// they disagree. Cancelled dependencies don't affect the exit code.
+func (e *DepsError) ExitStatus() int {
+	exit := 0
+	for _, f := range e.Failures {
+		if !f.Cancelled {
+			exit = changeExit(exit, f.Code)
+		}
+	}
+	if exit == 0 {
+		return 1
+	}
+	return exit
+}
+
+// Format implements fmt.Formatter. The %+v verb prints a detailed, per
+// dependency report, all other verbs print the same as Error.
+func (e *DepsError) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		e.writeDetail(s, "")
+		return
+	}
+	_, _ = io.WriteString(s, e.Error())
+}
+
+func (e *DepsError) writeDetail(w io.Writer, indent string) {
+	if len(e.Failures) == 1 {
+		fmt.Fprintf(w, "1 dependency failed:")
+	} else {
+		fmt.Fprintf(w, "%d dependencies failed:", len(e.Failures))
+	}
+	for _, f := range e.Failures {
+		var nested *DepsError
+		switch {
+		case f.Cancelled:
+			fmt.Fprintf(w, "\n%s  %s: cancelled", indent, f.Name)
+		case errors.As(f.Err, &nested) && f.Stack == nil:
+			fmt.Fprintf(w, "\n%s  %s: ", indent, f.Name)
+			nested.writeDetail(w, indent+"  ")
+		case f.Stack != nil:
+			fmt.Fprintf(w, "\n%s  %s: panic: %v", indent, f.Name, f.Err)
+			for _, line := range strings.Split(strings.TrimSpace(string(f.Stack)), "\n") {
+				fmt.Fprintf(w, "\n%s      %s", indent, line)
+			}
+		default:
+			fmt.Fprintf(w, "\n%s  %s: %v", indent, f.Name, f.Err)
+		}
+	}
+}
+
+func (f DepFailure) message() string {
+	if !f.Cancelled {
+		return fmt.Sprint(f.Err)
+	}
+	var cause *depFailedError
+	if errors.As(f.Err, &cause) {
+		return fmt.Sprintf("%s was cancelled because %s failed", f.Name, cause.fn)
+	}
+	return fmt.Sprintf("%s was cancelled: %v", f.Name, f.Err)
+}
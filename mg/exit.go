@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import "flag"
+
+// exitHooksFlag is the name of the flag the compiled magefile registers in
+// flag.CommandLine to let this package register functions to call when it
+// exits, like targetContextFlag. The flag's value implements flag.Getter, and
+// Get returns a func(func()) that registers a function.
+const exitHooksFlag = "mage.exithooks"
+
+// AtExit registers fn to be called when the compiled magefile exits after
+// running its targets, whether they succeeded or not, e.g. to stop a server a
+// target started. Functions are called in the reverse order they were
+// registered. Outside of a compiled magefile, e.g. in tests, fn is never
+// called.
+func AtExit(fn func()) {
+	f := flag.Lookup(exitHooksFlag)
+	if f == nil {
+		return
+	}
+	if g, ok := f.Value.(flag.Getter); ok {
+		if add, ok := g.Get().(func(func())); ok {
+			add(fn)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// depHooks holds the hooks registered with BeforeDep and AfterDep.
+var depHooks = struct {
+	mu     sync.Mutex
+	before []func(ctx context.Context, name string) error
+	after  []func(ctx context.Context, name string, err error)
+}{}
+
+// BeforeDep registers a function to call before every dependency run by Deps
+// and its variants, with the context and name of the dependency. Hooks are
+// called in the order they were registered. If a hook returns an error, the
+// dependency isn't run and fails with that error. Dependencies that already
+// ran don't call the hooks again.
+//
+// Hooks are usually registered from an init function, or from the magefile's
+// BeforeTarget hook.
+func BeforeDep(fn func(ctx context.Context, name string) error) {
+	depHooks.mu.Lock()
+	defer depHooks.mu.Unlock()
+	depHooks.before = append(depHooks.before, fn)
+}
+
+// AfterDep registers a function to call after every dependency run by Deps and
+// its variants, with the error the dependency returned, if any. It is called
+// even if the dependency panics, but not if a hook registered with BeforeDep
+// failed.
+func AfterDep(fn func(ctx context.Context, name string, err error)) {
+	depHooks.mu.Lock()
+	defer depHooks.mu.Unlock()
+	depHooks.after = append(depHooks.after, fn)
+}
+
+// runHooked runs the dependency between the registered hooks.
+func (o *onceFun) runHooked(ctx context.Context) (err error) {
+	depHooks.mu.Lock()
+	before, after := depHooks.before, depHooks.after
+	depHooks.mu.Unlock()
+
+	name := o.String()
+	for _, hook := range before {
+		if err := hook(ctx, name); err != nil {
+			return err
+		}
+	}
+	if len(after) > 0 {
+		defer func() {
+			v := recover()
+			if v != nil {
+				var ok bool
+				if err, ok = v.(error); !ok {
+					err = fmt.Errorf("%v", v)
+				}
+			}
+			for _, hook := range after {
+				hook(ctx, name, err)
+			}
+			if v != nil {
+				panic(v)
+			}
+		}()
+	}
+	return o.fn.Run(ctx)
+}
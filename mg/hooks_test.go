@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDepHooks(t *testing.T) {
+	defer func() {
+		depHooks.before, depHooks.after = nil, nil
+	}()
+	mu := &sync.Mutex{}
+	var calls []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, s)
+	}
+	BeforeDep(func(ctx context.Context, name string) error {
+		record("before " + name)
+		if name == "hooks.denied" {
+			return errors.New("not allowed")
+		}
+		return nil
+	})
+	AfterDep(func(ctx context.Context, name string, err error) {
+		record("after " + name + ": " + errString(err))
+	})
+
+	fail := fn{name: "hooks.fail", f: func(context.Context) error { return errors.New("boom") }}
+	denied := fn{name: "hooks.denied", f: func(context.Context) error {
+		t.Error("expected the dependency not to run when a before hook fails")
+		return nil
+	}}
+	ok := fn{name: "hooks.ok", f: func(context.Context) error { return nil }}
+
+	for _, f := range []Fn{ok, fail, denied, ok} {
+		func() {
+			defer func() { recover() }()
+			Deps(f)
+		}()
+	}
+	expected := []string{
+		"before hooks.ok",
+		"after hooks.ok: <nil>",
+		"before hooks.fail",
+		"after hooks.fail: boom",
+		"before hooks.denied",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected hooks to be called as\n%q\nbut got\n%q", expected, calls)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return err.Error()
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// The output modes that may be set with the -output flag.
+const (
+	// OutputRaw writes the output of dependencies as it comes.
+	OutputRaw = "raw"
+	// OutputPrefixed prefixes each line of output with the name of the
+	// dependency that wrote it.
+	OutputPrefixed = "prefixed"
+	// OutputGrouped holds back the output of each dependency until it
+	// finishes, and then writes it all at once.
+	OutputGrouped = "grouped"
+)
+
+// OutputEnv is the environment variable that holds the output mode, which
+// decides how the output of commands run by parallel dependencies is kept from
+// interleaving. See OutputRaw, OutputPrefixed and OutputGrouped.
+const OutputEnv = "MAGEFILE_OUTPUT"
+
+// OutputMode returns the output mode set with the -output flag. It defaults to
+// OutputRaw.
+func OutputMode() string {
+	switch m := os.Getenv(OutputEnv); m {
+	case OutputPrefixed, OutputGrouped:
+		return m
+	default:
+		return OutputRaw
+	}
+}
+
+type depKey struct{}
+
+// depState is the state of a running dependency, which Context stores in the
+// context it returns.
+type depState struct {
+	name string
+
+	// held is the output written so far in grouped mode.
+	mu   sync.Mutex
+	held []heldOutput
+}
+
+type heldOutput struct {
+	w io.Writer
+	b []byte
+}
+
+// outputMu serializes writes of whole lines or groups to the underlying
+// writers, so that they never interleave.
+var outputMu sync.Mutex
+
+// depOf returns the state of the dependency the context belongs to, as
+// returned by Context, or else of the dependency being run by the calling
+// goroutine.
+func depOf(ctx context.Context) *depState {
+	if d, ok := ctx.Value(depKey{}).(*depState); ok {
+		return d
+	}
+	if o := graph.current(); o != nil {
+		return o.state
+	}
+	return nil
+}
+
+// DepName returns the name of the dependency the context belongs to, as
+// returned by Context, or else of the dependency being run by the calling
+// goroutine. It returns "" outside of a dependency.
+func DepName(ctx context.Context) string {
+	if d := depOf(ctx); d != nil {
+		return d.name
+	}
+	return ""
+}
+
+// DepWriter returns a writer for output that the dependency the context
+// belongs to (see DepName) writes to w, according to the output mode: prefixed
+// with the name of the dependency line by line, or held back until the
+// dependency finishes. The writer must be closed once the output is complete.
+// In raw mode, or outside of a dependency, the writer writes straight to w.
+func DepWriter(ctx context.Context, w io.Writer) io.WriteCloser {
+	d := depOf(ctx)
+	if d == nil {
+		return nopCloser{w}
+	}
+	switch OutputMode() {
+	case OutputPrefixed:
+		return &prefixWriter{w: w, prefix: []byte("[" + d.name + "] ")}
+	case OutputGrouped:
+		return &groupWriter{w: w, d: d}
+	default:
+		return nopCloser{w}
+	}
+}
+
+// flush writes the output held back for the dependency.
+func (d *depState) flush() {
+	d.mu.Lock()
+	held := d.held
+	d.held = nil
+	d.mu.Unlock()
+	if len(held) == 0 {
+		return
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	for _, h := range held {
+		h.w.Write(h.b)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// prefixWriter writes each complete line with the prefix. The last line is
+// written on Close, even if it has no newline.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) Close() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
+
+// groupWriter holds back everything written to it until the dependency
+// finishes.
+type groupWriter struct {
+	w io.Writer
+	d *depState
+}
+
+func (g *groupWriter) Write(b []byte) (int, error) {
+	g.d.mu.Lock()
+	defer g.d.mu.Unlock()
+	g.d.held = append(g.d.held, heldOutput{w: g.w, b: append([]byte{}, b...)})
+	return len(b), nil
+}
+
+func (g *groupWriter) Close() error { return nil }
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &prefixWriter{w: buf, prefix: []byte("[Test] ")}
+	fmt.Fprint(w, "one\ntw")
+	fmt.Fprint(w, "o\nthree")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[Test] one\n[Test] two\n[Test] three\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestDepWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	write := func(ctx context.Context, s string) {
+		w := DepWriter(ctx, buf)
+		fmt.Fprint(w, s)
+		w.Close()
+	}
+	write(context.Background(), "not a dep\n")
+
+	t.Setenv(OutputEnv, OutputPrefixed)
+	var name string
+	SerialDeps(F(func(ctx context.Context, s string) {
+		name = DepName(ctx)
+		write(ctx, s)
+	}, "prefixed"))
+	if name == "" {
+		t.Fatal("expected the dependency's context to have its name")
+	}
+
+	t.Setenv(OutputEnv, OutputGrouped)
+	held := buf.Len()
+	SerialDeps(F(func(ctx context.Context, s string) {
+		write(ctx, s)
+		if buf.Len() != held {
+			t.Errorf("expected grouped output to be held back, got %q", buf.String())
+		}
+		write(ctx, "more\n")
+	}, "grouped\n"))
+
+	expected := "not a dep\n" +
+		"[" + name + "] prefixed\n" +
+		"grouped\nmore\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
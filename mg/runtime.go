@@ -1,3 +1,9 @@
+// SPDX-License-Identifier: Apache-2.0
+// Modifications Copyright (c) 2026 Actualyze AI
+//
+// NOTE: This file has been modified by Actualyze AI from the original upstream
+// version (magefile/mage). See git history for details.
+
 package mg
 
 import (
@@ -5,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"time"
 )
 
 // CacheEnv is the environment variable that users may set to change the
@@ -64,6 +71,33 @@ const EnableColorEnv = "MAGEFILE_ENABLE_COLOR"
 // - BrightWhite
 const TargetColorEnv = "MAGEFILE_TARGET_COLOR"
 
+// JobsEnv is the environment variable that indicates the maximum number of
+// dependencies that mg.Deps and mg.CtxDeps may run at the same time. Zero or
+// unset means there is no limit.
+const JobsEnv = "MAGEFILE_JOBS"
+
+// FailFastEnv is the environment variable that indicates the user requested
+// that the first failing dependency cancel the rest of its siblings.
+const FailFastEnv = "MAGEFILE_FAILFAST"
+
+// TraceEnv is the environment variable that holds the path of the file a trace
+// of the run is written to, in the Chrome trace event format.
+const TraceEnv = "MAGEFILE_TRACE"
+
+// TimingsEnv is the environment variable that indicates the user requested a
+// table of how long each target and dependency took at the end of the run.
+const TimingsEnv = "MAGEFILE_TIMINGS"
+
+// GracePeriodEnv is the environment variable that sets how long commands run
+// with a context, e.g. by sh.RunCtx, are given to exit after being asked to
+// terminate before they are killed. It is parsed with time.ParseDuration.
+const GracePeriodEnv = "MAGEFILE_GRACEPERIOD"
+
+// DefaultGracePeriod is the grace period used when GracePeriodEnv isn't set. It
+// is shorter than the time mage waits for targets to clean up after an
+// interrupt, so that commands are killed before mage exits.
+const DefaultGracePeriod = 3 * time.Second
+
 // Verbose reports whether a magefile was run with the verbose flag.
 func Verbose() bool {
 	b, _ := strconv.ParseBool(os.Getenv(VerboseEnv))
@@ -76,6 +110,48 @@ func Debug() bool {
 	return b
 }
 
+// Jobs reports the maximum number of dependencies that may run in parallel, as
+// set by the -j flag or the MAGEFILE_JOBS environment variable. It returns 0 if
+// there is no limit.
+func Jobs() int {
+	n, err := strconv.Atoi(os.Getenv(JobsEnv))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// FailFast reports whether a magefile was run with the failfast flag. In fail
+// fast mode, the first dependency of a Deps call to fail cancels the context
+// passed to its siblings, and siblings that haven't started yet are not run.
+func FailFast() bool {
+	b, _ := strconv.ParseBool(os.Getenv(FailFastEnv))
+	return b
+}
+
+// TraceFile returns the path of the file a trace of the run is written to, or
+// "" if the magefile wasn't run with the trace flag.
+func TraceFile() string {
+	return os.Getenv(TraceEnv)
+}
+
+// Timings reports whether a magefile was run with the timings flag.
+func Timings() bool {
+	b, _ := strconv.ParseBool(os.Getenv(TimingsEnv))
+	return b
+}
+
+// GracePeriod returns how long a command that is cancelled is given to exit
+// before it is killed, as set by the MAGEFILE_GRACEPERIOD environment
+// variable. It defaults to DefaultGracePeriod.
+func GracePeriod() time.Duration {
+	d, err := time.ParseDuration(os.Getenv(GracePeriodEnv))
+	if err != nil || d < 0 {
+		return DefaultGracePeriod
+	}
+	return d
+}
+
 // GoCmd reports the command that Mage will use to build go code.  By default mage runs
 // the "go" binary in the PATH.
 func GoCmd() string {
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactEnv is the environment variable that holds a comma separated list of
+// patterns, in path.Match syntax, for the names of environment variables whose
+// values are secrets, e.g. "*_TOKEN,AWS_*". It defaults to
+// DefaultRedactPatterns.
+const RedactEnv = "MAGEFILE_REDACT_ENV"
+
+// RedactOutputEnv is the environment variable that indicates the user
+// requested that secrets be redacted from the output of commands, as well as
+// from logs and errors.
+const RedactOutputEnv = "MAGEFILE_REDACT_OUTPUT"
+
+// DefaultRedactPatterns are the patterns used when RedactEnv isn't set.
+const DefaultRedactPatterns = "*_TOKEN,*_PASSWORD,*_SECRET"
+
+// Redacted replaces secrets in redacted text.
+const Redacted = "***"
+
+// minSecretLen is the length of the shortest value that is redacted. Shorter
+// values, like "1" or "yes", would hide too much of the text around them.
+const minSecretLen = 4
+
+// secrets holds the values registered with Secret.
+var secrets = struct {
+	mu     sync.Mutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// Secret registers value as a secret, which Redact replaces wherever it
+// appears, and returns it unchanged, so that it can wrap wherever a secret is
+// read:
+//
+//	token := mg.Secret(readToken())
+//
+// The sh package redacts secrets from the commands it logs with -v and from
+// its errors.
+func Secret(value string) string {
+	if len(value) >= minSecretLen {
+		secrets.mu.Lock()
+		secrets.values[value] = true
+		secrets.mu.Unlock()
+	}
+	return value
+}
+
+// SecretEnv reports whether the environment variable with the given name holds
+// a secret, because its name matches one of the patterns in RedactEnv. Names
+// are matched regardless of case.
+func SecretEnv(name string) bool {
+	patterns := os.Getenv(RedactEnv)
+	if patterns == "" {
+		patterns = DefaultRedactPatterns
+	}
+	name = strings.ToUpper(name)
+	for _, p := range strings.Split(patterns, ",") {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactOutput reports whether the user requested that secrets be redacted
+// from the output of commands.
+func RedactOutput() bool {
+	b, _ := strconv.ParseBool(os.Getenv(RedactOutputEnv))
+	return b
+}
+
+// Redact replaces every secret in s with Redacted. Secrets are the values
+// registered with Secret, and the values of the environment variables for
+// which SecretEnv reports true.
+func Redact(s string) string {
+	r := redactor()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// redactor returns a replacer for the current secrets, or nil if there are
+// none.
+func redactor() *strings.Replacer {
+	secrets.mu.Lock()
+	values := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		values = append(values, v)
+	}
+	secrets.mu.Unlock()
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if len(v) >= minSecretLen && SecretEnv(k) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// replace longer secrets first, so that a secret containing another one is
+	// replaced entirely.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// RedactWriter returns a writer that redacts secrets (see Redact) from what is
+// written to it before writing it to w. Output is written a line at a time, so
+// that a secret split across writes is still found. The writer must be closed
+// to write the last line if it has no newline.
+func RedactWriter(w io.Writer) io.WriteCloser {
+	return &redactWriter{w: w}
+}
+
+type redactWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (r *redactWriter) Write(b []byte) (int, error) {
+	r.buf = append(r.buf, b...)
+	i := bytes.LastIndexByte(r.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	lines := r.buf[:i+1]
+	r.buf = append([]byte{}, r.buf[i+1:]...)
+	if _, err := io.WriteString(r.w, Redact(string(lines))); err != nil {
+		return len(b), err
+	}
+	return len(b), nil
+}
+
+func (r *redactWriter) Close() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, Redact(string(r.buf)))
+	r.buf = nil
+	return err
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package mg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Setenv("MAGE_TEST_TOKEN", "tok-from-env")
+	t.Setenv("MAGE_TEST_SHORT_TOKEN", "abc")
+	t.Setenv("MAGE_TEST_PUBLIC", "not-a-secret")
+	Secret("registered-secret")
+
+	got := Redact("a registered-secret, a tok-from-env, an abc and not-a-secret")
+	want := "a ***, a ***, an abc and not-a-secret"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	t.Setenv(RedactEnv, "*_public")
+	got = Redact("tok-from-env and not-a-secret")
+	want = "tok-from-env and ***"
+	if got != want {
+		t.Fatalf("expected patterns from %s to be used, got %q", RedactEnv, got)
+	}
+}
+
+func TestRedactWriter(t *testing.T) {
+	Secret("split-secret")
+	buf := &bytes.Buffer{}
+	w := RedactWriter(buf)
+	for _, s := range []string{"one split-", "secret\ntwo split", "-secret"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "one ***\ntwo ***"; buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf)
+	}
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package parse
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// mgImportPath is the import path of the package that declares mg.Deps.
+const mgImportPath = "github.com/actualyze-ai/mage/mg"
+
+// Dep is a dependency declared in the body of a function by a call to mg.Deps,
+// mg.SerialDeps, mg.CtxDeps or mg.SerialCtxDeps.
+type Dep struct {
+	// Name is the name of the function as it is referred to in the package,
+	// e.g. "build", "Docs.Generate" or "pkg.Target".
+	Name string
+	// Args holds the source of the arguments passed to the function with
+	// mg.F, if any.
+	Args []string
+	// Serial reports whether the dependency was declared with mg.SerialDeps or
+	// mg.SerialCtxDeps.
+	Serial bool
+}
+
+// depFuncs are the mg functions that declare dependencies, mapped to whether
+// the dependencies are run serially and whether the first argument is a
+// context.
+var depFuncs = map[string]struct{ serial, ctx bool }{
+	"Deps":          {false, false},
+	"SerialDeps":    {true, false},
+	"CtxDeps":       {false, true},
+	"SerialCtxDeps": {true, true},
+}
+
+// funcKey returns the name used to look up the dependencies of a function
+// declared with the given receiver type and name.
+func funcKey(receiver, name string) string {
+	if receiver == "" {
+		return name
+	}
+	return receiver + "." + name
+}
+
+// setDeps finds the dependencies declared in the body of every function in the
+// package. It has to run before doc.New, which strips function bodies.
+func setDeps(pi *PkgInfo) {
+	pi.Deps = map[string][]Dep{}
+	for _, f := range pi.AstPkg.Files {
+		mg := mgImportName(f)
+		if mg == "" {
+			continue
+		}
+		for _, d := range f.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok || decl.Body == nil {
+				continue
+			}
+			receiver := ""
+			if decl.Recv != nil && len(decl.Recv.List) == 1 {
+				receiver = types.ExprString(decl.Recv.List[0].Type)
+			}
+			if deps := findDeps(decl.Body, mg); len(deps) > 0 {
+				key := funcKey(receiver, decl.Name.Name)
+				debug.Printf("found %d dependencies of %s", len(deps), key)
+				pi.Deps[key] = deps
+			}
+		}
+	}
+}
+
+// mgImportName returns the name the file imports the mg package as, or "" if
+// it doesn't import it.
+func mgImportName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		path, ok := lit2string(imp.Path)
+		if !ok || path != mgImportPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return "mg"
+	}
+	return ""
+}
+
+// findDeps returns the dependencies declared in body, in the order they are
+// declared.
+func findDeps(body *ast.BlockStmt, mg string) []Dep {
+	var deps []Dep
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		name, ok := mgCall(call, mg)
+		if !ok {
+			return true
+		}
+		kind, ok := depFuncs[name]
+		if !ok {
+			return true
+		}
+		args := call.Args
+		if kind.ctx && len(args) > 0 {
+			args = args[1:]
+		}
+		for _, arg := range args {
+			deps = append(deps, newDep(arg, mg, kind.serial))
+		}
+		return true
+	})
+	return deps
+}
+
+// newDep creates a Dep for an argument passed to one of the mg.Deps functions.
+func newDep(arg ast.Expr, mg string, serial bool) Dep {
+	dep := Dep{Serial: serial}
+	if call, ok := arg.(*ast.CallExpr); ok && len(call.Args) > 0 {
+		if name, ok := mgCall(call, mg); ok && name == "F" {
+			dep.Name = depName(call.Args[0])
+			for _, a := range call.Args[1:] {
+				dep.Args = append(dep.Args, types.ExprString(a))
+			}
+			return dep
+		}
+	}
+	dep.Name = depName(arg)
+	return dep
+}
+
+// mgCall returns the name of the mg function called by call, if any.
+func mgCall(call *ast.CallExpr, mg string) (string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || id.Name != mg {
+		return "", false
+	}
+	return sel.Sel.Name, true
+}
+
+// depName returns the name of the function passed as a dependency. Namespace
+// methods may be passed as a method expression (Docs.Generate) or a method
+// value (Docs{}.Generate), both are returned as "Docs.Generate". Anything else
+// is returned as written.
+func depName(e ast.Expr) string {
+	if sel, ok := e.(*ast.SelectorExpr); ok {
+		if lit, ok := sel.X.(*ast.CompositeLit); ok && lit.Type != nil {
+			return types.ExprString(lit.Type) + "." + sel.Sel.Name
+		}
+	}
+	return types.ExprString(e)
+}
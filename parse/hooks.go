@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// hookSigs maps the names of the lifecycle hooks a magefile may declare to the
+// signature they must have. Hooks are called by the compiled magefile around
+// every target run from the command line, and are never targets themselves.
+var hookSigs = map[string]string{
+	"BeforeTarget": "func(context.Context, string) error",
+	"AfterTarget":  "func(context.Context, string, error)",
+}
+
+// setHooks records which lifecycle hooks the package declares. It's an error
+// for a function to have the name of a hook but not its signature.
+func setHooks(pi *PkgInfo) error {
+	for _, f := range pi.DocPkg.Funcs {
+		want, ok := hookSigs[f.Name]
+		if !ok || f.Recv != "" {
+			continue
+		}
+		if got := funcSig(f.Decl.Type); got != want {
+			return fmt.Errorf("hook %s must be declared as %s, but is %s", f.Name, want, got)
+		}
+		debug.Printf("found hook %s", f.Name)
+		switch f.Name {
+		case "BeforeTarget":
+			pi.BeforeTarget = true
+		case "AfterTarget":
+			pi.AfterTarget = true
+		}
+	}
+	return nil
+}
+
+// isHook reports whether a function with the given name is a lifecycle hook
+// rather than a target.
+func isHook(name string) bool {
+	_, ok := hookSigs[name]
+	return ok
+}
+
+// funcSig returns the signature of a function type without parameter names,
+// e.g. "func(context.Context, string) error".
+func funcSig(ft *ast.FuncType) string {
+	params := fieldTypes(ft.Params)
+	results := fieldTypes(ft.Results)
+	sig := "func(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+		return sig
+	case 1:
+		return sig + " " + results[0]
+	default:
+		return sig + " (" + strings.Join(results, ", ") + ")"
+	}
+}
+
+func fieldTypes(fields *ast.FieldList) []string {
+	if fields == nil {
+		return nil
+	}
+	var out []string
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, types.ExprString(f.Type))
+		}
+	}
+	return out
+}
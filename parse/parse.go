@@ -17,6 +17,7 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,13 +36,16 @@ func EnableDebug() {
 // PkgInfo contains inforamtion about a package of files according to mage's
 // parsing rules.
 type PkgInfo struct {
-	AstPkg      *ast.Package
-	DocPkg      *doc.Package
-	Description string
-	Funcs       Functions
-	DefaultFunc *Function
-	Aliases     map[string]*Function
-	Imports     Imports
+	AstPkg       *ast.Package
+	DocPkg       *doc.Package
+	Description  string
+	Funcs        Functions
+	DefaultFunc  *Function
+	Aliases      map[string]*Function
+	Imports      Imports
+	Deps         map[string][]Dep // dependencies declared by each function, see Function.Deps
+	BeforeTarget bool             // whether the package declares a BeforeTarget hook
+	AfterTarget  bool             // whether the package declares an AfterTarget hook
 }
 
 // Function represents a job function from a mage file
@@ -56,6 +60,7 @@ type Function struct {
 	Synopsis   string
 	Comment    string
 	Args       []Arg
+	Deps       []Dep // dependencies declared in the function body with mg.Deps and friends
 }
 
 var _ sort.Interface = (Functions)(nil)
@@ -109,7 +114,7 @@ func (f Function) TargetName() string {
 
 // ExecCode returns code for the template switch to run the target.
 // It wraps each target call to match the func(context.Context) error that
-// runTarget requires.
+// runTarget requires, and passes the target's name along for reporting.
 func (f Function) ExecCode() string {
 	name := f.Name
 	if f.Receiver != "" {
@@ -183,7 +188,7 @@ func (f Function) ExecCode() string {
 	}
 	out += `
 				}
-				ret := runTarget(logger, wrapFn)`
+				ret := runTarget(logger, ` + strconv.Quote(f.TargetName()) + `, wrapFn)`
 	return out
 }
 
@@ -257,13 +262,18 @@ func Package(path string, files []string) (*PkgInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	p := doc.New(pkg, "./", 0)
 	pi := &PkgInfo{
-		AstPkg:      pkg,
-		DocPkg:      p,
-		Description: toOneLine(p.Doc),
+		AstPkg: pkg,
 	}
+	// must happen before doc.New, which strips the function bodies.
+	setDeps(pi)
+	p := doc.New(pkg, "./", 0)
+	pi.DocPkg = p
+	pi.Description = toOneLine(p.Doc)
 
+	if err := setHooks(pi); err != nil {
+		return nil, err
+	}
 	setNamespaces(pi)
 	setFuncs(pi)
 
@@ -320,6 +330,18 @@ func getImport(gocmd, importpath, alias string) (*Import, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the compiled magefile only calls the hooks of the magefile itself, so
+	// imported ones would silently do nothing.
+	hook := ""
+	switch {
+	case info.BeforeTarget:
+		hook = "BeforeTarget"
+	case info.AfterTarget:
+		hook = "AfterTarget"
+	}
+	if hook != "" {
+		return nil, fmt.Errorf("imported package %s declares hook %s, but hooks are only called when declared in the magefile", importpath, hook)
+	}
 	for i := range info.Funcs {
 		debug.Printf("setting alias %q and package %q on func %v", alias, name, info.Funcs[i].Name)
 		info.Funcs[i].PkgAlias = alias
@@ -367,6 +389,10 @@ func setFuncs(pi *PkgInfo) {
 			// skip non-exported functions
 			continue
 		}
+		if isHook(f.Name) {
+			debug.Printf("skipping hook %s", f.Name)
+			continue
+		}
 		fn, err := funcType(f.Decl.Type)
 		if err != nil {
 			debug.Printf("skipping function with invalid signature func %s: %v", f.Name, err)
@@ -376,6 +402,7 @@ func setFuncs(pi *PkgInfo) {
 		fn.Name = f.Name
 		fn.Comment = toOneLine(f.Doc)
 		fn.Synopsis = sanitizeSynopsis(f)
+		fn.Deps = pi.Deps[f.Name]
 		pi.Funcs = append(pi.Funcs, fn)
 	}
 }
@@ -400,6 +427,7 @@ func setNamespaces(pi *PkgInfo) {
 			fn.Comment = toOneLine(f.Doc)
 			fn.Synopsis = sanitizeSynopsis(f)
 			fn.Receiver = t.Name
+			fn.Deps = pi.Deps[funcKey(t.Name, f.Name)]
 
 			pi.Funcs = append(pi.Funcs, fn)
 		}
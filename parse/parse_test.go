@@ -34,6 +34,7 @@ func TestParse(t *testing.T) {
 		},
 		{
 			Name: "ReturnsVoid",
+			Deps: []Dep{{Name: "f"}},
 		},
 		{
 			Name:      "TakesContextReturnsError",
@@ -109,6 +110,58 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseDeps(t *testing.T) {
+	info, err := Package("./testdata/deps", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Dep{
+		{Name: "Generate"},
+		{Name: "compile", Args: []string{`"server"`, "2"}},
+		{Name: "Docs.Generate", Serial: true},
+		{Name: "Docs.Generate", Serial: true},
+	}
+	for _, f := range info.Funcs {
+		if f.Name != "Build" {
+			continue
+		}
+		if !reflect.DeepEqual(f.Deps, expected) {
+			t.Fatalf("expected deps:\n%#v\nbut got:\n%#v", expected, f.Deps)
+		}
+		return
+	}
+	t.Fatal("Build target not found")
+}
+
+func TestParseHooks(t *testing.T) {
+	info, err := Package("./testdata/hooks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.BeforeTarget || !info.AfterTarget {
+		t.Fatalf("expected both hooks to be found, got BeforeTarget %v, AfterTarget %v", info.BeforeTarget, info.AfterTarget)
+	}
+	if len(info.Funcs) != 1 || info.Funcs[0].Name != "Build" {
+		t.Fatalf("expected Build to be the only target, got %v", info.Funcs)
+	}
+}
+
+func TestParseBadHook(t *testing.T) {
+	_, err := Package("./testdata/badhook", nil)
+	expected := "hook BeforeTarget must be declared as func(context.Context, string) error, but is func(string)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestParseImportedHook(t *testing.T) {
+	_, err := getImport("go", "github.com/actualyze-ai/mage/parse/testdata/importhook", "")
+	expected := "imported package github.com/actualyze-ai/mage/parse/testdata/importhook declares hook AfterTarget, but hooks are only called when declared in the magefile"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
 func TestGetImportSelf(t *testing.T) {
 	imp, err := getImport("go", "github.com/actualyze-ai/mage/parse/testdata/importself", "")
 	if err != nil {
@@ -0,0 +1,25 @@
+//go:build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import (
+	"context"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+type Docs mg.Namespace
+
+func (Docs) Generate() {}
+
+func Build(ctx context.Context) {
+	mg.CtxDeps(ctx, Generate, mg.F(compile, "server", 2))
+	mg.SerialDeps(Docs.Generate, Docs{}.Generate)
+}
+
+func Generate() {}
+
+func compile(name string, n int) {}
@@ -0,0 +1,17 @@
+//go:build mage
+// +build mage
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package main
+
+import "context"
+
+func BeforeTarget(ctx context.Context, name string) error {
+	return nil
+}
+
+func AfterTarget(ctx context.Context, name string, err error) {}
+
+func Build() {}
@@ -0,0 +1,11 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package importhook
+
+import "context"
+
+// AfterTarget would only be called if it were declared in the magefile.
+func AfterTarget(ctx context.Context, name string, err error) {}
+
+func Build() {}
@@ -0,0 +1,511 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// ArchiveFormat is the kind of archive Archive writes.
+type ArchiveFormat int
+
+const (
+	// TarGz is a gzip compressed tarball.
+	TarGz ArchiveFormat = iota + 1
+	// Zip is a zip file with deflated entries.
+	Zip
+)
+
+// SourceDateEpochEnv is the environment variable that, when set to a unix
+// time, sets the time Archive gives entries by default, following
+// https://reproducible-builds.org/specs/source-date-epoch/.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// defaultArchiveTime is the earliest time a zip file can hold.
+var defaultArchiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ArchiveOptions controls what Archive puts in an archive. Include and Exclude
+// select files as they do for CopyDir.
+type ArchiveOptions struct {
+	Include []string
+	Exclude []string
+	// Prefix is a directory, like "myapp-1.0", to put the entries under.
+	Prefix string
+	// ModTime is the time given to every entry. The default is the time in
+	// $SOURCE_DATE_EPOCH if it is set, and 1980-01-01 otherwise.
+	ModTime time.Time
+}
+
+// archiveEntry is a file, directory or symlink to put in an archive.
+type archiveEntry struct {
+	name string // slash-separated path in the archive, with a trailing slash for directories
+	path string
+	mode fs.FileMode
+	link string
+}
+
+// Archive writes the contents of the directory srcDir to the archive dst in
+// the given format. The output only depends on the names, contents and
+// executable bits of the files, so archiving the same tree twice gives the
+// same bytes: entries are sorted, owners are dropped, every entry has the same
+// time, and modes are normalized to 0755 for directories and executables and
+// 0644 for other files. Symlinks are stored as symlinks. If dst is inside
+// srcDir, it is left out of the archive.
+func Archive(dst, srcDir string, format ArchiveFormat, opts ArchiveOptions) (err error) {
+	if mg.Verbose() {
+		log.Printf("archive: %s -> %s", srcDir, dst)
+	}
+	if format != TarGz && format != Zip {
+		return fmt.Errorf(`can't archive %s: unknown archive format %d`, srcDir, format)
+	}
+	mtime, err := archiveTime(opts.ModTime)
+	if err != nil {
+		return err
+	}
+	skip, err := within(srcDir, dst)
+	if err != nil {
+		return fmt.Errorf(`can't archive %s: %v`, srcDir, err)
+	}
+	entries, err := archiveEntries(srcDir, skip, opts)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf(`can't create %s: %v`, dst, err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf(`error writing %s: %v`, dst, cerr)
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	if format == Zip {
+		err = writeZip(w, entries, mtime)
+	} else {
+		err = writeTarGz(w, entries, mtime)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf(`error writing %s: %v`, dst, err)
+	}
+	return nil
+}
+
+func archiveTime(t time.Time) (time.Time, error) {
+	if !t.IsZero() {
+		return t.UTC(), nil
+	}
+	s := os.Getenv(SourceDateEpochEnv)
+	if s == "" {
+		return defaultArchiveTime, nil
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`invalid %s %q: %v`, SourceDateEpochEnv, s, err)
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// archiveEntries lists what goes in an archive of srcDir, sorted by name,
+// leaving out the entry with the slash-separated relative path skip.
+func archiveEntries(srcDir, skip string, opts ArchiveOptions) ([]archiveEntry, error) {
+	prefix := strings.Trim(filepath.ToSlash(opts.Prefix), "/")
+	byName := map[string]archiveEntry{}
+	// addDirs adds the directories above the slash-separated name.
+	addDirs := func(name string) {
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			byName[d+"/"] = archiveEntry{name: d + "/", mode: fs.ModeDir | 0o755}
+		}
+	}
+	err := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == skip {
+			// an archive written into its own source isn't packed into
+			// the next one.
+			return nil
+		}
+		name := path.Join(prefix, rel)
+		if d.IsDir() {
+			if matchAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			if len(opts.Include) == 0 {
+				addDirs(name + "/x")
+			}
+			return nil
+		}
+		if !selected(opts.Include, opts.Exclude, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{name: name, path: p, mode: 0o644}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if e.link, err = os.Readlink(p); err != nil {
+				return err
+			}
+			e.mode = fs.ModeSymlink | 0o777
+		case !info.Mode().IsRegular():
+			return fmt.Errorf(`%s is not a regular file`, p)
+		case info.Mode()&0o111 != 0:
+			e.mode = 0o755
+		}
+		byName[name] = e
+		addDirs(name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`can't archive %s: %v`, srcDir, err)
+	}
+	entries := make([]archiveEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+func writeTarGz(w io.Writer, entries []archiveEntry, mtime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.name,
+			Mode:    int64(e.mode.Perm()),
+			ModTime: mtime,
+		}
+		switch {
+		case e.mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+		case e.mode&fs.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.link
+		default:
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		err := withFile(e.path, func(f *os.File, size int64) error {
+			hdr.Size = size
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.CopyN(tw, f, size)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(w io.Writer, entries []archiveEntry, mtime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: mtime}
+		hdr.SetMode(e.mode)
+		if e.mode.IsDir() {
+			hdr.Method = zip.Store
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case e.mode.IsDir():
+		case e.mode&fs.ModeSymlink != 0:
+			if _, err := io.WriteString(fw, e.link); err != nil {
+				return err
+			}
+		default:
+			err := withFile(e.path, func(f *os.File, size int64) error {
+				_, err := io.CopyN(fw, f, size)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// withFile opens the file name and calls fn with it and its size.
+func withFile(name string, fn func(f *os.File, size int64) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return fn(f, info.Size())
+}
+
+// Extract unpacks the tar.gz or zip file archive, whichever it is, into the
+// directory dstDir, creating it if necessary. Entries that would end up
+// outside dstDir, whether by an absolute path, "..", or a path through a
+// symlink, are refused, as are symlinks pointing out of dstDir, so an
+// untrusted archive can't write anywhere else.
+func Extract(archive, dstDir string) error {
+	if mg.Verbose() {
+		log.Printf("extract: %s -> %s", archive, dstDir)
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf(`can't extract %s: %v`, archive, err)
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return fmt.Errorf(`can't extract %s: %v`, archive, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`can't extract %s: %v`, archive, err)
+	}
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return fmt.Errorf(`can't create %s: %v`, dstDir, err)
+	}
+	x := extractor{root: dstDir}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		err = x.tarGz(f)
+	case bytes.Equal(magic, []byte("PK\x03\x04")), bytes.Equal(magic, []byte("PK\x05\x06")):
+		info, serr := f.Stat()
+		if serr != nil {
+			return fmt.Errorf(`can't extract %s: %v`, archive, serr)
+		}
+		err = x.zip(f, info.Size())
+	default:
+		return fmt.Errorf(`can't extract %s: not a tar.gz or zip file`, archive)
+	}
+	if err != nil {
+		return fmt.Errorf(`can't extract %s: %v`, archive, err)
+	}
+	return nil
+}
+
+// extractor writes archive entries under root.
+type extractor struct {
+	root string
+}
+
+func (x extractor) tarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(hdr.Name, mode)
+		case tar.TypeReg:
+			err = x.file(hdr.Name, mode, hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+		default:
+			err = fmt.Errorf(`%s: unsupported entry type %q`, hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x extractor) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(zf.Name, mode.Perm())
+		case mode&fs.ModeSymlink != 0:
+			err = x.zipLink(zf)
+		case mode.IsRegular():
+			err = x.zipFile(zf, mode.Perm())
+		default:
+			err = fmt.Errorf(`%s: unsupported file mode %v`, zf.Name, mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x extractor) zipFile(zf *zip.File, mode fs.FileMode) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.file(zf.Name, mode, zf.Modified, rc)
+}
+
+func (x extractor) zipLink(zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, 4<<10))
+	if err != nil {
+		return err
+	}
+	return x.symlink(zf.Name, string(target))
+}
+
+// path returns where the entry name goes, refusing names that would escape
+// root and replacing a symlink that is already there.
+func (x extractor) path(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(slashed, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf(`%s: illegal path in archive`, name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf(`%s: illegal path in archive`, name)
+		}
+	}
+	rel := path.Clean(slashed)
+	if rel == "." {
+		return x.root, nil
+	}
+	parts := strings.Split(rel, "/")
+	p := x.root
+	for i, part := range parts {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if i < len(parts)-1 {
+			return "", fmt.Errorf(`%s: path goes through a symlink`, name)
+		}
+		if err := os.Remove(p); err != nil {
+			return "", err
+		}
+	}
+	return p, nil
+}
+
+func (x extractor) dir(name string, mode fs.FileMode) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, mode|0o700)
+}
+
+func (x extractor) file(name string, mode fs.FileMode, mtime time.Time, r io.Reader) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// a file from an earlier extraction may be read-only, so it is replaced
+	// rather than written to.
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(p, mtime, mtime)
+}
+
+func (x extractor) symlink(name, target string) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	t := filepath.ToSlash(target)
+	dest := path.Join(path.Dir(strings.TrimSuffix(name, "/")), t)
+	if target == "" || path.IsAbs(t) || filepath.IsAbs(target) || dest == ".." || strings.HasPrefix(dest, "../") {
+		return fmt.Errorf(`%s: symlink to %s points outside the destination`, name, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if err := Rm(p); err != nil {
+		return err
+	}
+	return os.Symlink(target, p)
+}
@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, format := range []ArchiveFormat{TarGz, Zip} {
+		src, dir := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{
+			"bin/tool":     "#!/bin/sh",
+			"README.md":    "readme",
+			"lib/a.go":     "a",
+			"lib/a.go.bak": "old",
+			"tmp/scratch":  "x",
+		})
+		if err := os.Chmod(filepath.Join(src, "bin", "tool"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "out")
+		opts := ArchiveOptions{Prefix: "app-1.0", Exclude: []string{"*.bak", "tmp"}}
+		if err := Archive(dst, src, format, opts); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, "extracted")
+		if err := Extract(dst, out); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{
+			"app-1.0/bin/tool":  "#!/bin/sh",
+			"app-1.0/README.md": "readme",
+			"app-1.0/lib/a.go":  "a",
+		}
+		if got := readTree(t, out); !reflect.DeepEqual(got, want) {
+			t.Fatalf("format %d: expected %v, got %v", format, want, got)
+		}
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(filepath.Join(out, "app-1.0", "bin", "tool"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0o755 {
+				t.Fatalf("format %d: expected executable to be extracted with mode 0755, got %#o", format, info.Mode().Perm())
+			}
+		}
+	}
+}
+
+func TestArchiveDeterministic(t *testing.T) {
+	for _, format := range []ArchiveFormat{TarGz, Zip} {
+		var archives [][]byte
+		for i := 0; i < 2; i++ {
+			src := t.TempDir()
+			writeTree(t, src, map[string]string{"b.txt": "b", "a/c.txt": "c"})
+			// times and permissions that don't matter differ between the two.
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			if err := os.Chtimes(filepath.Join(src, "b.txt"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filepath.Join(src, "b.txt"), os.FileMode(0o600|i*0o044)); err != nil {
+				t.Fatal(err)
+			}
+			dst := filepath.Join(t.TempDir(), "out")
+			if err := Archive(dst, src, format, ArchiveOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archives = append(archives, b)
+		}
+		if !bytes.Equal(archives[0], archives[1]) {
+			t.Fatalf("format %d: archiving the same files twice gave different archives", format)
+		}
+	}
+}
+
+func TestArchiveIntoSource(t *testing.T) {
+	for _, format := range []ArchiveFormat{TarGz, Zip} {
+		src := t.TempDir()
+		writeTree(t, src, map[string]string{"a.txt": "a"})
+		dst := filepath.Join(src, "dist", "out")
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// the second archive would hold the first if it weren't left out.
+		for i := 0; i < 2; i++ {
+			if err := Archive(dst, src, format, ArchiveOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out := t.TempDir()
+		if err := Extract(dst, out); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"a.txt": "a"}
+		if got := readTree(t, out); !reflect.DeepEqual(got, want) {
+			t.Fatalf("format %d: expected %v, got %v", format, want, got)
+		}
+	}
+}
+
+func TestArchiveSourceDateEpoch(t *testing.T) {
+	t.Setenv(SourceDateEpochEnv, "1700000000")
+	src, dir := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"f.txt": "f"})
+	dst := filepath.Join(dir, "out.tar.gz")
+	if err := Archive(dst, src, TarGz, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Extract(dst, dir); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "f.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1700000000, 0); !info.ModTime().Equal(want) {
+		t.Fatalf("expected modification time %v, got %v", want, info.ModTime())
+	}
+}
+
+// tarGz returns a tar.gz file holding the given headers, with regular files
+// containing "evil".
+func tarGz(t *testing.T, hdrs ...*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = 4
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte("evil")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "ro.tar.gz")
+	data := tarGz(t, &tar.Header{Name: "ro.txt", Typeflag: tar.TypeReg, Mode: 0o444})
+	if err := os.WriteFile(archive, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	for i := 0; i < 2; i++ {
+		if err := Extract(archive, out); err != nil {
+			t.Fatalf("extraction %d: %v", i+1, err)
+		}
+	}
+	if got := readTree(t, out); got["ro.txt"] != "evil" {
+		t.Fatalf("expected the read-only file to be extracted again, got %v", got)
+	}
+}
+
+func TestExtractTraversal(t *testing.T) {
+	tests := map[string][]*tar.Header{
+		"dotdot":   {{Name: "../evil", Typeflag: tar.TypeReg}},
+		"nested":   {{Name: "a/../../evil", Typeflag: tar.TypeReg}},
+		"absolute": {{Name: "/tmp/evil", Typeflag: tar.TypeReg}},
+		"link out": {{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		"link abs": {{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		"through link": {
+			{Name: "d/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "d/l/evil", Typeflag: tar.TypeReg},
+		},
+	}
+	for name, hdrs := range tests {
+		t.Run(name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && strings.Contains(name, "link") {
+				t.Skip("creating symlinks needs extra privileges on windows")
+			}
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "evil.tar.gz")
+			if err := os.WriteFile(archive, tarGz(t, hdrs...), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := Extract(archive, filepath.Join(dir, "out", "x"))
+			if err == nil {
+				t.Fatal("expected extraction to fail")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out", "evil")); !os.IsNotExist(err) {
+				t.Fatalf("expected nothing to be written outside the destination, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractZipTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("../evil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Extract(archive, filepath.Join(dir, "out")); err == nil {
+		t.Fatal("expected extraction to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written outside the destination, got %v", err)
+	}
+}
@@ -8,13 +8,16 @@ package sh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/actualyze-ai/mage/internal"
 	"github.com/actualyze-ai/mage/mg"
 )
 
@@ -95,6 +98,25 @@ func OutputWith(env map[string]string, cmd string, args ...string) (string, erro
 	return strings.TrimSuffix(buf.String(), "\n"), err
 }
 
+// RunCtx is like Run, but stops the command when ctx is done. See ExecCtx for
+// how the command is stopped.
+func RunCtx(ctx context.Context, cmd string, args ...string) error {
+	var output io.Writer
+	if mg.Verbose() {
+		output = os.Stdout
+	}
+	_, err := ExecCtx(ctx, nil, output, os.Stderr, cmd, args...)
+	return err
+}
+
+// OutputCtx is like Output, but stops the command when ctx is done. See
+// ExecCtx for how the command is stopped.
+func OutputCtx(ctx context.Context, cmd string, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	_, err := ExecCtx(ctx, nil, buf, os.Stderr, cmd, args...)
+	return strings.TrimSuffix(buf.String(), "\n"), err
+}
+
 // Exec executes the command, piping its stdout and stderr to the given
 // writers. If the command fails, it will return an error that, if returned
 // from a target or mg.Deps call, will cause mage to exit with the same code as
@@ -104,68 +126,233 @@ func OutputWith(env map[string]string, cmd string, args ...string) (string, erro
 // to environment variables in $FOO format, in which case these will be
 // expanded before the command is run.
 //
+// If the command ran but failed, the error is an *ExitError, which keeps the end
+// of the command's stderr.
+//
 // Ran reports if the command ran (rather than was not found or not executable).
 // Code reports the exit code the command returned if it ran. If err == nil, ran
 // is always true and code is always 0.
 func Exec(env map[string]string, stdout, stderr io.Writer, cmd string, args ...string) (ran bool, err error) {
+	return ExecCtx(context.Background(), env, stdout, stderr, cmd, args...)
+}
+
+// ExecCtx is like Exec, but stops the command when ctx is done, e.g. because
+// the user interrupted mage or a dependency failed in fail fast mode.
+//
+// The command is started in its own process group, so that the processes it
+// starts can be stopped with it. When ctx is done, the group is sent SIGTERM,
+// and whatever is still running after the grace period (see mg.GracePeriod),
+// or is left behind when the command exits before then, is sent SIGKILL. On
+// Windows, the command is killed right away. Because the command isn't in the
+// terminal's foreground process group, it can't read from the terminal; use
+// Exec for interactive commands.
+//
+// If the command is stopped, the returned error wraps the cause of ctx being
+// done (see context.Cause), so errors.Is(err, context.DeadlineExceeded)
+// reports whether it ran out of time. If ctx can never be done, like
+// context.Background(), ExecCtx behaves exactly like Exec.
+func ExecCtx(ctx context.Context, env map[string]string, stdout, stderr io.Writer, cmd string, args ...string) (ran bool, err error) {
+	return execute(ctx, &Invocation{
+		Name:   cmd,
+		Args:   args,
+		Env:    env,
+		Stdin:  os.Stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+// execute expands the environment variables in the command and its arguments,
+// runs it, and turns a failure into an error mage understands.
+func execute(ctx context.Context, c *Invocation) (ran bool, err error) {
+	expandInvocation(c)
+	return executeTapped(ctx, c, tap{})
+}
+
+// expandInvocation expands the environment variables in the command and its
+// arguments, and registers the values of the variables set for the command
+// that hold secrets.
+func expandInvocation(c *Invocation) {
+	for k, v := range c.Env {
+		if mg.SecretEnv(k) {
+			mg.Secret(v)
+		}
+	}
 	expand := func(s string) string {
-		s2, ok := env[s]
+		s2, ok := c.Env[s]
 		if ok {
 			return s2
 		}
 		return os.Getenv(s)
 	}
-	cmd = os.Expand(cmd, expand)
-	for i := range args {
-		args[i] = os.Expand(args[i], expand)
+	c.Name = os.Expand(c.Name, expand)
+	for i := range c.Args {
+		c.Args[i] = os.Expand(c.Args[i], expand)
+	}
+}
+
+// tap holds writers that get a copy of what a command writes, besides the
+// writers of its Invocation.
+type tap struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// apply makes what is written to the stdout and stderr of inv also go to the
+// writers of the tap. If stdout and stderr are the same writer, they are kept
+// the same, so that os/exec keeps writing them from a single goroutine.
+func (t tap) apply(inv *Invocation) {
+	if inv.Stdout != nil && sameWriter(inv.Stdout, inv.Stderr) {
+		w := teeWriter(teeWriter(inv.Stdout, t.stdout), t.stderr)
+		inv.Stdout, inv.Stderr = w, w
+		return
+	}
+	inv.Stdout = teeWriter(inv.Stdout, t.stdout)
+	inv.Stderr = teeWriter(inv.Stderr, t.stderr)
+}
+
+// teeWriter returns a writer that writes to both w and tee, either of which
+// may be nil.
+func teeWriter(w, tee io.Writer) io.Writer {
+	switch {
+	case tee == nil:
+		return w
+	case w == nil:
+		return tee
+	default:
+		return io.MultiWriter(w, tee)
 	}
-	ran, code, err := run(env, stdout, stderr, cmd, args...)
+}
+
+// sameWriter reports whether a and b are the same writer, without panicking if
+// they aren't comparable.
+func sameWriter(a, b io.Writer) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// executeTapped is like execute for a command whose environment variables
+// were already expanded, which copies its output to t.
+func executeTapped(ctx context.Context, c *Invocation, t tap) (ran bool, err error) {
+	tail := &tailBuffer{size: StderrTailSize}
+	t.stderr = teeWriter(t.stderr, tail)
+	start := time.Now()
+	ran, code, err := run(ctx, c, t)
 	if err == nil {
 		return true, nil
 	}
+	cmdline := mg.Redact(c.Name + " " + strings.Join(c.Args, " "))
+	if ctx.Err() != nil {
+		// a command that was killed didn't exit, but it did run.
+		_, killed := err.(*exec.ExitError)
+		return ran || killed, fmt.Errorf(`running "%s" was cancelled: %w`, cmdline, context.Cause(ctx))
+	}
 	if ran {
-		return ran, mg.Fatalf(code, `running "%s %s" failed with exit code %d`, cmd, strings.Join(args, " "), code)
+		return ran, &ExitError{
+			Name:            c.Name,
+			Args:            c.Args,
+			Dir:             c.Dir,
+			Code:            code,
+			Duration:        time.Since(start),
+			Stderr:          tail.buf,
+			StderrTruncated: tail.truncated,
+			Err:             err,
+		}
 	}
-	return ran, fmt.Errorf(`failed to run "%s %s: %v"`, cmd, strings.Join(args, " "), err)
+	return ran, fmt.Errorf(`failed to run "%s: %w"`, cmdline, err)
 }
 
-func run(env map[string]string, stdout, stderr io.Writer, cmd string, args ...string) (ran bool, code int, err error) {
-	c := exec.Command(cmd, args...)
-	c.Env = os.Environ()
-	for k, v := range env {
-		c.Env = append(c.Env, k+"="+v)
-	}
-	c.Stderr = stderr
-	c.Stdout = stdout
-	c.Stdin = os.Stdin
+// run runs the command with the Executor for ctx, logging and tracing it, and
+// copies its output to t.
+func run(ctx context.Context, cmd *Invocation, t tap) (ran bool, code int, err error) {
+	inv := *cmd
+	var flushOut, flushErr func() error
+	inv.Stderr, flushErr = streamOutput(cmd.Stderr, os.Stderr)
+	inv.Stdout, flushOut = streamOutput(cmd.Stdout, os.Stdout)
+	t.apply(&inv)
+	defer flushErr()
+	defer flushOut()
 
 	var quoted []string
-	for i := range args {
-		quoted = append(quoted, fmt.Sprintf("%q", args[i]))
+	for i := range cmd.Args {
+		quoted = append(quoted, fmt.Sprintf("%q", cmd.Args[i]))
 	}
 	// To protect against logging from doing exec in global variables
 	if mg.Verbose() {
-		log.Println("exec:", cmd, strings.Join(quoted, " "))
+		log.Println(mg.Redact("exec: " + cmd.Name + " " + strings.Join(quoted, " ")))
 	}
-	err = c.Run()
-	return CmdRan(err), ExitStatus(err), err
+	end := internal.TraceSpan("exec", mg.Redact(strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")))
+	err = executorFor(ctx).Run(ctx, &inv)
+	ran, code = CmdRan(err), ExitStatus(err)
+	status := "ok"
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		status = "cancelled"
+	default:
+		status = "failed"
+	}
+	end(status, map[string]interface{}{"code": code})
+	return ran, code, err
+}
+
+// streamOutput wraps w if it is the terminal stream std, so that output that
+// is streamed to the terminal is redacted if mage was run with
+// MAGEFILE_REDACT_OUTPUT, and written according to the output mode set with
+// -output if the command is run by a dependency, so that the output of
+// dependencies running in parallel doesn't interleave. Output that is
+// captured, e.g. by Output, is left alone, and so is everything in raw mode
+// without redaction, so that commands still write straight to the terminal.
+// The returned function flushes the output once the command is done.
+func streamOutput(w io.Writer, std *os.File) (io.Writer, func() error) {
+	nop := func() error { return nil }
+	if f, ok := w.(*os.File); !ok || f != std {
+		return w, nop
+	}
+	flush := nop
+	if ctx := mg.Context(); mg.OutputMode() != mg.OutputRaw && mg.DepName(ctx) != "" {
+		dw := mg.DepWriter(ctx, w)
+		w, flush = dw, dw.Close
+	}
+	if mg.RedactOutput() {
+		rw, flushDep := mg.RedactWriter(w), flush
+		w, flush = rw, func() error {
+			err := rw.Close()
+			if err2 := flushDep(); err == nil {
+				err = err2
+			}
+			return err
+		}
+	}
+	return w, flush
 }
 
 // CmdRan examines the error to determine if it was generated as a result of a
 // command running via os/exec.Command.  If the error is nil, or the command ran
-// (even if it exited with a non-zero exit code), CmdRan reports true.  If the
-// error is an unrecognized type, or it is an error from exec.Command that says
-// the command failed to run (usually due to the command not existing or not
-// being executable), it reports false.
+// (even if it exited with a non-zero exit code), CmdRan reports true.  An error
+// that isn't from os/exec but implements ExitStatus() int, like the errors
+// returned by Exec for commands that failed, is also from a command that ran.
+// A *PipeError is from a command that ran if its failed stage's error is.
+// If the error is an unrecognized type, or it is an error from exec.Command
+// that says the command failed to run (usually due to the command not existing
+// or not being executable), it reports false.
 func CmdRan(err error) bool {
 	if err == nil {
 		return true
 	}
+	if pe, ok := err.(*PipeError); ok {
+		return CmdRan(pe.Err)
+	}
 	ee, ok := err.(*exec.ExitError)
 	if ok {
 		return ee.Exited()
 	}
-	return false
+	_, ok = err.(exitStatus)
+	return ok
 }
 
 type exitStatus interface {
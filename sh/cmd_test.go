@@ -8,8 +8,16 @@ package sh
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"log"
 	"os"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
 )
 
 func TestOutCmd(t *testing.T) {
@@ -75,3 +83,101 @@ func TestAutoExpand(t *testing.T) {
 		t.Fatalf(`Expected "baz" but got %q`, s)
 	}
 }
+
+func TestExecCtxCancel(t *testing.T) {
+	cause := errors.New("stop")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(100*time.Millisecond, func() { cancel(cause) })
+
+	start := time.Now()
+	ran, err := ExecCtx(ctx, nil, nil, nil, os.Args[0], "-helper", "-sleep", "1m")
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected error to wrap the cancellation cause, got %v", err)
+	}
+	if !ran {
+		t.Error("expected ran to be true")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected the command to stop soon after cancellation, took %v", d)
+	}
+}
+
+func TestExecCtxGracePeriod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows commands are killed right away")
+	}
+	t.Setenv(mg.GracePeriodEnv, "200ms")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ExecCtx(ctx, nil, nil, nil, os.Args[0], "-helper", "-ignoreTerm", "-sleep", "1m")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "was cancelled") {
+		t.Fatalf("expected error to say the command was cancelled, got %q", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected a command ignoring SIGTERM to be killed after the grace period, took %v", d)
+	}
+}
+
+func TestOutputCtx(t *testing.T) {
+	out, err := OutputCtx(context.Background(), os.Args[0], "-printArgs", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[foo]" {
+		t.Fatalf("expected %q but got %q", "[foo]", out)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	t.Setenv(mg.VerboseEnv, "1")
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	RegisterSecret("hunter22")
+	env := map[string]string{"MAGE_TEST_PASSWORD": "swordfish"}
+	_, err := Exec(env, nil, nil, os.Args[0], "-helper", "-exit", "2", "hunter22", "$MAGE_TEST_PASSWORD")
+	if err == nil {
+		t.Fatal("unexpected nil error")
+	}
+	for _, s := range []string{buf.String(), err.Error()} {
+		if strings.Contains(s, "hunter22") || strings.Contains(s, "swordfish") {
+			t.Fatalf("expected secrets to be redacted, got %q", s)
+		}
+		if strings.Count(s, "***") != 2 {
+			t.Fatalf("expected redacted arguments, got %q", s)
+		}
+	}
+}
+
+func TestExitError(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Command(os.Args[0], "-helper", "-stderr", "first\nsecond", "-exit", "4").Dir(dir).Quiet().Output(context.Background())
+	var ee *ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("expected an *ExitError, got %#v", err)
+	}
+	if ee.Name != os.Args[0] || ee.Dir != dir || ee.Code != 4 || ExitStatus(err) != 4 {
+		t.Fatalf("unexpected error fields: %+v", ee)
+	}
+	if ee.Duration <= 0 {
+		t.Fatalf("expected the duration to be recorded, got %v", ee.Duration)
+	}
+	if tail := ee.StderrTail(); tail != "first\nsecond" {
+		t.Fatalf("expected the stderr tail %q, got %q", "first\nsecond", tail)
+	}
+
+	long := strings.Repeat("x", StderrTailSize) + "\nlast"
+	_, err = Exec(nil, nil, nil, os.Args[0], "-helper", "-stderr", long, "-exit", "1")
+	if !errors.As(err, &ee) || !ee.StderrTruncated || len(ee.Stderr) != StderrTailSize {
+		t.Fatalf("expected the stderr to be truncated, got %#v", err)
+	}
+	if tail := ee.StderrTail(); tail != "...\nlast" {
+		t.Fatalf("expected the partial first line to be dropped, got %q", tail)
+	}
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// Builder configures a command to run. Create one with Command, set it up with
+// its chainable methods, and run it with Run, Output, CombinedOutput or Lines:
+//
+//	err := sh.Command("go", "test", "./...").
+//		Dir("pkg").
+//		Env("CGO_ENABLED", "0").
+//		Timeout(5 * time.Minute).
+//		Run(ctx)
+//
+// The command is run like ExecCtx runs it: environment variables in $FOO
+// format are expanded in the command and its arguments, it is logged when mage
+// is run with -v, it is stopped when the context is done, and a non-zero exit
+// code fails mage with the same code.
+//
+// The methods modify the Builder and return it, so a Builder shouldn't be
+// shared between goroutines while it's being set up.
+type Builder struct {
+	cmd     Invocation
+	timeout time.Duration
+	quiet   bool
+}
+
+// Command returns a Builder for running cmd with the given arguments.
+func Command(cmd string, args ...string) *Builder {
+	return &Builder{cmd: Invocation{
+		Name:  cmd,
+		Args:  args,
+		Stdin: os.Stdin,
+	}}
+}
+
+// Dir sets the working directory of the command. By default it runs in the
+// current directory.
+func (b *Builder) Dir(dir string) *Builder {
+	b.cmd.Dir = dir
+	return b
+}
+
+// Env sets an environment variable for the command, overriding the value from
+// the current environment.
+func (b *Builder) Env(key, value string) *Builder {
+	if b.cmd.Env == nil {
+		b.cmd.Env = map[string]string{}
+	}
+	b.cmd.Env[key] = value
+	return b
+}
+
+// ClearEnv runs the command with only the variables set with Env, rather than
+// with the current environment plus those variables.
+func (b *Builder) ClearEnv() *Builder {
+	b.cmd.ClearEnv = true
+	return b
+}
+
+// Stdin sets what the command reads from. By default it reads this process's
+// stdin. A nil reader makes the command read from the null device.
+func (b *Builder) Stdin(r io.Reader) *Builder {
+	b.cmd.Stdin = r
+	return b
+}
+
+// Timeout stops the command if it runs longer than d, the same way it would be
+// stopped if the context it is run with was done.
+func (b *Builder) Timeout(d time.Duration) *Builder {
+	b.timeout = d
+	return b
+}
+
+// Quiet discards what the command would otherwise write to this process's
+// stdout and stderr. Output that is returned, e.g. by Output, is kept.
+func (b *Builder) Quiet() *Builder {
+	b.quiet = true
+	return b
+}
+
+// Run runs the command, sending its stderr to this process's stderr and its
+// stdout to this process's stdout if mage was run with -v, like RunWith.
+func (b *Builder) Run(ctx context.Context) error {
+	var stdout io.Writer
+	if mg.Verbose() {
+		stdout = os.Stdout
+	}
+	return b.exec(ctx, b.cmd.Stdin, stdout, os.Stderr)
+}
+
+// Output runs the command and returns what it wrote to stdout, without the
+// trailing newline, like Output.
+func (b *Builder) Output(ctx context.Context) (string, error) {
+	buf := &bytes.Buffer{}
+	err := b.exec(ctx, b.cmd.Stdin, buf, os.Stderr)
+	return strings.TrimSuffix(buf.String(), "\n"), err
+}
+
+// CombinedOutput runs the command and returns what it wrote to stdout and
+// stderr, interleaved as it was written, without the trailing newline.
+func (b *Builder) CombinedOutput(ctx context.Context) (string, error) {
+	buf := &bytes.Buffer{}
+	err := b.exec(ctx, b.cmd.Stdin, buf, buf)
+	return strings.TrimSuffix(buf.String(), "\n"), err
+}
+
+// Lines runs the command and returns what it wrote to stdout, split into
+// lines. Line endings are removed, including Windows ones.
+func (b *Builder) Lines(ctx context.Context) ([]string, error) {
+	out, err := b.Output(ctx)
+	return splitLines(out), err
+}
+
+// splitLines splits output into lines without their line endings.
+func splitLines(out string) []string {
+	if out == "" {
+		return nil
+	}
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+func (b *Builder) exec(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	if b.quiet {
+		if stdout == os.Stdout {
+			stdout = nil
+		}
+		if stderr == os.Stderr {
+			stderr = nil
+		}
+	}
+	// run a copy, so that expanding the arguments leaves the Builder as it was
+	// and it can be run again.
+	c := b.cmd
+	c.Args = append([]string(nil), b.cmd.Args...)
+	c.Stdin, c.Stdout, c.Stderr = stdin, stdout, stderr
+	_, err := execute(ctx, &c)
+	return err
+}
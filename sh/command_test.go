@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandOutput(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	out, err := Command(os.Args[0], "-printWd").Dir(dir).Output(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(dir)
+	if got, _ := filepath.EvalSymlinks(out); got != want {
+		t.Fatalf("expected the command to run in %q, got %q", want, got)
+	}
+
+	out, err = Command(os.Args[0], "-cat").Stdin(strings.NewReader("one\ntwo\n")).Output(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "one\ntwo" {
+		t.Fatalf("expected stdin to be passed to the command, got %q", out)
+	}
+
+	lines, err := Command(os.Args[0], "-cat").Stdin(strings.NewReader("one\r\ntwo\n")).Lines(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected lines %q, got %q", want, lines)
+	}
+
+	out, err = Command(os.Args[0], "-helper", "-stdout", "out", "-stderr", "err").Quiet().CombinedOutput(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "out") || !strings.Contains(out, "err") {
+		t.Fatalf("expected stdout and stderr in the combined output, got %q", out)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("MAGE_TEST_INHERITED", "inherited")
+
+	cmd := Command(os.Args[0], "-printVar", "MAGE_TEST_SET").Env("MAGE_TEST_SET", "set")
+	out, err := cmd.Output(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "set" {
+		t.Fatalf("expected %q, got %q", "set", out)
+	}
+
+	out, err = Command(os.Args[0], "-printVar", "MAGE_TEST_INHERITED").ClearEnv().Output(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Fatalf("expected a cleared environment, got %q", out)
+	}
+
+	out, err = Command(os.Args[0], "-printArgs", "$MAGE_TEST_INHERITED").Output(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[inherited]" {
+		t.Fatalf("expected arguments to be expanded, got %q", out)
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	ctx := context.Background()
+	err := Command(os.Args[0], "-helper", "-exit", "3").Quiet().Run(ctx)
+	if ExitStatus(err) != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+
+	start := time.Now()
+	err = Command(os.Args[0], "-helper", "-sleep", "1m").Timeout(100 * time.Millisecond).Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected the command to time out, took %v", d)
+	}
+}
@@ -0,0 +1,463 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/actualyze-ai/mage/internal"
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// SymlinkPolicy says what CopyDir and Sync do with symbolic links in the source
+// tree.
+type SymlinkPolicy int
+
+const (
+	// SymlinkCopy recreates links in the destination with the same target.
+	SymlinkCopy SymlinkPolicy = iota
+	// SymlinkFollow copies the files and directories that links point to.
+	SymlinkFollow
+	// SymlinkSkip leaves links out of the copy.
+	SymlinkSkip
+)
+
+// CopyOptions controls what CopyDir and Sync copy and how.
+//
+// Include and Exclude are glob patterns matched against the slash-separated
+// path of each entry relative to the source directory, where "**" matches any
+// number of directories. A pattern without a slash is matched against the
+// entry's name at any depth, so "*.tmp" excludes every .tmp file. When Include
+// is set only files that match one of its patterns are copied; an excluded
+// directory is skipped with everything in it.
+//
+// Permission bits are always copied.
+type CopyOptions struct {
+	Include       []string
+	Exclude       []string
+	Symlinks      SymlinkPolicy
+	PreserveTimes bool // set the modification times of copies to those of the source
+	Delete        bool // Sync only: remove files in the destination that aren't in the source
+}
+
+// CopyDir recursively copies the contents of the directory src into dst,
+// creating dst if necessary and overwriting any files already there. If dst is
+// inside src, it is left out of the copy.
+func CopyDir(dst, src string, opts CopyOptions) error {
+	if mg.Verbose() {
+		log.Printf("copy: %s -> %s", src, dst)
+	}
+	_, err := copyTree(dst, src, opts, false)
+	return err
+}
+
+// Sync makes dst a copy of the directory src like rsync does, only copying
+// files whose size or modification time differ from the destination's copy.
+// Modification times are always preserved so that the next Sync can tell what
+// changed. With opts.Delete, files and directories in dst that aren't in src
+// are removed, except for those that opts excludes. Like CopyDir, Sync leaves
+// dst out of the copy if it is inside src.
+func Sync(dst, src string, opts CopyOptions) error {
+	if mg.Verbose() {
+		log.Printf("sync: %s -> %s", src, dst)
+	}
+	opts.PreserveTimes = true
+	st, err := copyTree(dst, src, opts, true)
+	if err != nil {
+		return err
+	}
+	if mg.Verbose() {
+		log.Printf("sync: %d copied, %d unchanged, %d deleted", st.copied, st.unchanged, st.deleted)
+	}
+	return nil
+}
+
+// rename is replaced in tests to simulate moves across filesystems.
+var rename = os.Rename
+
+// Move moves the file or directory src to dst. When they are on different
+// filesystems, which a rename can't handle, src is copied to dst with its
+// permissions, modification times and symlinks and then removed.
+func Move(dst, src string) error {
+	if mg.Verbose() {
+		log.Printf("move: %s -> %s", src, dst)
+	}
+	err := rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf(`can't move %s: %v`, src, err)
+	}
+	switch {
+	case info.IsDir():
+		_, err = copyTree(dst, src, CopyOptions{PreserveTimes: true}, false)
+	case info.Mode()&fs.ModeSymlink != 0:
+		err = copyLink(dst, src)
+	default:
+		err = copyFile(dst, src, info, true)
+	}
+	if err != nil {
+		return err
+	}
+	return Rm(src)
+}
+
+// syncStats counts what Sync did, for its log.
+type syncStats struct {
+	copied, unchanged, deleted int
+}
+
+// copier walks a source tree and copies the entries that its options select.
+type copier struct {
+	opts   CopyOptions
+	sync   bool
+	stats  syncStats
+	skip   string          // relative path of the destination, if it's in the source
+	kept   map[string]bool // relative paths of the entries in the source
+	active map[string]bool // real paths of the directories being walked
+	dirs   []dirAttrs
+}
+
+// dirAttrs are the permissions and time that a directory of the copy gets once
+// it has been filled.
+type dirAttrs struct {
+	path  string
+	perm  fs.FileMode
+	mtime time.Time
+}
+
+func copyTree(dst, src string, opts CopyOptions, sync bool) (syncStats, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return syncStats{}, fmt.Errorf(`can't copy %s: %v`, src, err)
+	}
+	if !info.IsDir() {
+		return syncStats{}, fmt.Errorf(`can't copy %s: not a directory`, src)
+	}
+	skip, err := within(src, dst)
+	if err != nil {
+		return syncStats{}, fmt.Errorf(`can't copy %s: %v`, src, err)
+	}
+	if skip == "." {
+		return syncStats{}, fmt.Errorf(`can't copy %s onto itself`, src)
+	}
+	c := &copier{
+		opts:   opts,
+		sync:   sync,
+		skip:   skip,
+		kept:   map[string]bool{},
+		active: map[string]bool{},
+	}
+	if err := c.mkdir(dst, info); err != nil {
+		return c.stats, err
+	}
+	if err := c.walk(dst, src, ""); err != nil {
+		return c.stats, err
+	}
+	if sync && opts.Delete {
+		if err := c.prune(dst, ""); err != nil {
+			return c.stats, err
+		}
+	}
+	// directory permissions and times go last, since filling a directory
+	// changes its time, and a read-only one couldn't be filled.
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		d := c.dirs[i]
+		if opts.PreserveTimes {
+			if err := os.Chtimes(d.path, d.mtime, d.mtime); err != nil {
+				return c.stats, fmt.Errorf(`can't set times of %s: %v`, d.path, err)
+			}
+		}
+		if err := os.Chmod(d.path, d.perm); err != nil {
+			return c.stats, fmt.Errorf(`can't set permissions of %s: %v`, d.path, err)
+		}
+	}
+	return c.stats, nil
+}
+
+func (c *copier) walk(dst, src, rel string) error {
+	if c.opts.Symlinks == SymlinkFollow {
+		real, err := filepath.EvalSymlinks(src)
+		if err != nil {
+			return fmt.Errorf(`can't copy %s: %v`, src, err)
+		}
+		if c.active[real] {
+			return fmt.Errorf(`can't copy %s: symlink loop`, src)
+		}
+		c.active[real] = true
+		defer delete(c.active, real)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf(`can't copy %s: %v`, src, err)
+	}
+	for _, e := range entries {
+		r := path.Join(rel, e.Name())
+		if r == c.skip {
+			// don't copy the destination into itself.
+			continue
+		}
+		s := filepath.Join(src, e.Name())
+		d := filepath.Join(dst, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf(`can't stat %s: %v`, s, err)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			switch c.opts.Symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				if info, err = os.Stat(s); err != nil {
+					return fmt.Errorf(`can't stat %s: %v`, s, err)
+				}
+			}
+		}
+		if info.IsDir() {
+			if matchAny(c.opts.Exclude, r) {
+				continue
+			}
+			c.kept[r] = true
+			if len(c.opts.Include) == 0 {
+				if err := c.mkdir(d, info); err != nil {
+					return err
+				}
+			}
+			if err := c.walk(d, s, r); err != nil {
+				return err
+			}
+			continue
+		}
+		if !selected(c.opts.Include, c.opts.Exclude, r) {
+			continue
+		}
+		c.kept[r] = true
+		if err := c.copy(d, s, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdir creates the directory path, and its parents as needed. It is kept
+// writable while the copy fills it, and given the permissions of the source
+// directory info at the end.
+func (c *copier) mkdir(path string, info fs.FileInfo) error {
+	if err := os.MkdirAll(path, 0o777); err != nil {
+		return fmt.Errorf(`can't create %s: %v`, path, err)
+	}
+	if err := os.Chmod(path, info.Mode().Perm()|0o700); err != nil {
+		return fmt.Errorf(`can't set permissions of %s: %v`, path, err)
+	}
+	c.dirs = append(c.dirs, dirAttrs{path, info.Mode().Perm(), info.ModTime()})
+	return nil
+}
+
+func (c *copier) copy(dst, src string, info fs.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+		return fmt.Errorf(`can't create %s: %v`, filepath.Dir(dst), err)
+	}
+	existing, err := os.Lstat(dst)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf(`can't stat %s: %v`, dst, err)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if c.sync && existing != nil && existing.Mode()&fs.ModeSymlink != 0 {
+			to, _ := os.Readlink(src)
+			if cur, _ := os.Readlink(dst); cur == to {
+				c.stats.unchanged++
+				return nil
+			}
+		}
+		c.stats.copied++
+		return copyLink(dst, src)
+	}
+	if c.sync && existing != nil && existing.Mode().IsRegular() &&
+		existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime()) {
+		c.stats.unchanged++
+		if existing.Mode().Perm() != info.Mode().Perm() {
+			if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+				return fmt.Errorf(`can't set permissions of %s: %v`, dst, err)
+			}
+		}
+		return nil
+	}
+	if existing != nil && !existing.Mode().IsRegular() {
+		// replace directories and links rather than writing through them.
+		if err := Rm(dst); err != nil {
+			return err
+		}
+	}
+	c.stats.copied++
+	return copyFile(dst, src, info, c.opts.PreserveTimes)
+}
+
+// prune removes the entries under dst that weren't copied from the source,
+// leaving excluded ones alone.
+func (c *copier) prune(dst, rel string) error {
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return fmt.Errorf(`can't read %s: %v`, dst, err)
+	}
+	for _, e := range entries {
+		r := path.Join(rel, e.Name())
+		d := filepath.Join(dst, e.Name())
+		if matchAny(c.opts.Exclude, r) {
+			continue
+		}
+		if !c.kept[r] {
+			if e.IsDir() && len(c.opts.Include) > 0 && !c.hasIncluded(d, r) {
+				// directories that could hold nothing Include selects are
+				// left alone, like the files in them.
+				continue
+			}
+			if !e.IsDir() && !selected(c.opts.Include, nil, r) {
+				continue
+			}
+			if mg.Verbose() {
+				log.Printf("sync: deleting %s", d)
+			}
+			if err := Rm(d); err != nil {
+				return err
+			}
+			c.stats.deleted++
+			continue
+		}
+		if e.IsDir() {
+			if err := c.prune(d, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasIncluded reports whether the directory dir holds any file that Include
+// selects.
+func (c *copier) hasIncluded(dir, rel string) bool {
+	found := false
+	_ = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		r, _ := filepath.Rel(dir, name)
+		if selected(c.opts.Include, c.opts.Exclude, path.Join(rel, filepath.ToSlash(r))) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// copyFile copies the regular file src, whose info is given, to dst with the
+// same permissions and, if times is set, modification time. The copy is
+// written next to dst and renamed over it, so that a read-only dst is replaced
+// rather than written to.
+func copyFile(dst, src string, info fs.FileInfo, times bool) (err error) {
+	from, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf(`can't copy %s: %v`, src, err)
+	}
+	defer from.Close()
+	to, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return fmt.Errorf(`can't copy to %s: %v`, dst, err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(to.Name())
+		}
+	}()
+	if _, err := io.Copy(to, from); err != nil {
+		to.Close()
+		return fmt.Errorf(`error copying %s to %s: %v`, src, dst, err)
+	}
+	if err := to.Close(); err != nil {
+		return fmt.Errorf(`error copying %s to %s: %v`, src, dst, err)
+	}
+	if err := os.Chmod(to.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf(`can't set permissions of %s: %v`, dst, err)
+	}
+	if times {
+		if err := os.Chtimes(to.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf(`can't set times of %s: %v`, dst, err)
+		}
+	}
+	if err := os.Rename(to.Name(), dst); err != nil {
+		return fmt.Errorf(`error copying %s to %s: %v`, src, dst, err)
+	}
+	return nil
+}
+
+// copyLink recreates the symlink src at dst.
+func copyLink(dst, src string) error {
+	to, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf(`can't copy %s: %v`, src, err)
+	}
+	if err := Rm(dst); err != nil {
+		return err
+	}
+	if err := os.Symlink(to, dst); err != nil {
+		return fmt.Errorf(`can't copy %s to %s: %v`, src, dst, err)
+	}
+	return nil
+}
+
+// within returns the slash-separated path of name relative to the directory
+// dir if name is dir or inside it, or "" if it isn't.
+func within(dir, name string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absName)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// selected reports whether the slash-separated relative path name matches one
+// of the include patterns, or there are none, and none of the exclude ones.
+func selected(include, exclude []string, name string) bool {
+	if len(include) > 0 && !matchAny(include, name) {
+		return false
+	}
+	return !matchAny(exclude, name)
+}
+
+// matchAny reports whether the slash-separated relative path name matches any
+// of the patterns. A pattern without a slash matches the last element of name.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		p = strings.TrimPrefix(filepath.ToSlash(p), "./")
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		if internal.MatchGlob(strings.Split(p, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
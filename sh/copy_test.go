@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTree creates the files in the map, keyed by slash-separated path, under
+// dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the regular files under dir and their contents, keyed by
+// slash-separated path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCopyDir(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeTree(t, src, map[string]string{
+		"a.txt":          "a",
+		"b.tmp":          "b",
+		"sub/c.txt":      "c",
+		"sub/deep/d.txt": "d",
+		"skip/e.txt":     "e",
+	})
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(filepath.Join(src, "a.txt"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "sub", "c.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CopyDir(dst, src, CopyOptions{Exclude: []string{"*.tmp", "skip"}, PreserveTimes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.txt": "a", "sub/c.txt": "c", "sub/deep/d.txt": "d"}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected permissions 0600, got %#o", info.Mode().Perm())
+		}
+	}
+	info, err := os.Stat(filepath.Join(dst, "sub", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Fatalf("expected modification time %v, got %v", old, info.ModTime())
+	}
+}
+
+func TestCopyDirInclude(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{
+		"main.go":           "main",
+		"README.md":         "readme",
+		"pkg/lib.go":        "lib",
+		"pkg/lib_test.go":   "test",
+		"docs/guide/raw.md": "guide",
+	})
+	err := CopyDir(dst, src, CopyOptions{Include: []string{"**/*.go", "docs/**/*.md"}, Exclude: []string{"*_test.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"main.go": "main", "pkg/lib.go": "lib", "docs/guide/raw.md": "guide"}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCopyDirIntoSource(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	writeTree(t, src, files)
+	dst := filepath.Join(src, "sub", "out")
+	for i := 0; i < 2; i++ {
+		if err := CopyDir(dst, src, CopyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTree(t, dst); !reflect.DeepEqual(got, files) {
+			t.Fatalf("copy %d: expected %v, got %v", i+1, files, got)
+		}
+	}
+	if err := Sync(dst, src, CopyOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, files) {
+		t.Fatalf("sync: expected %v, got %v", files, got)
+	}
+	if err := CopyDir(src, src, CopyOptions{}); err == nil {
+		t.Fatal("expected an error copying a directory onto itself")
+	}
+}
+
+// makeWritable makes the directories under dir writable again when the test
+// ends, so that they can be removed.
+func makeWritable(t *testing.T, dir string) {
+	t.Cleanup(func() {
+		_ = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				_ = os.Chmod(name, 0o755)
+			}
+			return nil
+		})
+	})
+}
+
+func TestCopyDirReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no read-only directories")
+	}
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	makeWritable(t, src)
+	makeWritable(t, filepath.Dir(dst))
+	writeTree(t, src, map[string]string{"ro/f.txt": "f"})
+	if err := os.Chmod(filepath.Join(src, "ro", "f.txt"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	// copying again, and syncing a change, replace the read-only copies.
+	for i := 0; i < 2; i++ {
+		if err := CopyDir(dst, src, CopyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(src, "ro", "f.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, src, map[string]string{"ro/f.txt": "changed"})
+	if err := os.Chmod(filepath.Join(src, "ro", "f.txt"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sync(dst, src, CopyOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"ro/f.txt": "changed"}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for name, perm := range map[string]fs.FileMode{"ro": 0o555, "ro/f.txt": 0o444} {
+		info, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Fatalf("expected %s to have permissions %#o, got %#o", name, perm, info.Mode().Perm())
+		}
+	}
+}
+
+func TestCopyDirSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on windows")
+	}
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"real/f.txt": "f"})
+	if err := os.Symlink("real", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := CopyDir(dst, src, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if to, err := os.Readlink(filepath.Join(dst, "link")); err != nil || to != "real" {
+		t.Fatalf("expected link to real, got %q, %v", to, err)
+	}
+
+	dst = t.TempDir()
+	if err := CopyDir(dst, src, CopyOptions{Symlinks: SymlinkFollow}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"real/f.txt": "f", "link/f.txt": "f"}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	dst = t.TempDir()
+	if err := CopyDir(dst, src, CopyOptions{Symlinks: SymlinkSkip}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "link")); !os.IsNotExist(err) {
+		t.Fatalf("expected link to be skipped, got %v", err)
+	}
+
+	if err := os.Symlink("..", filepath.Join(src, "real", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyDir(t.TempDir(), src, CopyOptions{Symlinks: SymlinkFollow}); err == nil {
+		t.Fatal("expected an error following a symlink loop")
+	}
+}
+
+func TestSync(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	if err := Sync(dst, src, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// an unchanged file in the destination isn't rewritten, so a marker that
+	// keeps size and time is left alone.
+	marker := filepath.Join(dst, "a.txt")
+	info, err := os.Stat(marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(marker, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(marker, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, src, map[string]string{"sub/b.txt": "bb", "new.txt": "n"})
+	writeTree(t, dst, map[string]string{"extra.txt": "x", "gone/f.txt": "f", "keep.log": "l"})
+
+	if err := Sync(dst, src, CopyOptions{Delete: true, Exclude: []string{"*.log"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.txt": "x", "sub/b.txt": "bb", "new.txt": "n", "keep.log": "l"}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "gone")); !os.IsNotExist(err) {
+		t.Fatalf("expected extraneous directory to be deleted, got %v", err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"src/a.txt": "a", "src/sub/b.txt": "b", "file.txt": "f"})
+
+	if err := Move(filepath.Join(dir, "moved.txt"), filepath.Join(dir, "file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { rename = os.Rename }()
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: crossDeviceErr()}
+	}
+	if err := Move(filepath.Join(dir, "dst"), filepath.Join(dir, "src")); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for name := range readTree(t, dir) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"dst/a.txt", "dst/sub/b.txt", "moved.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	rename = func(oldpath, newpath string) error { return os.ErrPermission }
+	if err := Move(filepath.Join(dir, "x"), filepath.Join(dir, "dst")); err != os.ErrPermission {
+		t.Fatalf("expected other rename errors to be returned, got %v", err)
+	}
+}
+
+func crossDeviceErr() error {
+	if runtime.GOOS == "windows" {
+		return syscall.Errno(17)
+	}
+	return syscall.EXDEV
+}
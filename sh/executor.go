@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// Invocation describes a command for an Executor to run. Environment variables
+// in the command and its arguments have already been expanded.
+type Invocation struct {
+	Name     string
+	Args     []string
+	Env      map[string]string // variables to set in addition to the current environment
+	ClearEnv bool              // run with only Env rather than the current environment plus Env
+	Dir      string            // working directory, or "" for the current directory
+	Stdin    io.Reader
+	Stdout   io.Writer // may be nil to discard the output
+	Stderr   io.Writer // may be nil to discard the output
+}
+
+// Executor runs the commands of the sh package. Every function that runs a
+// command, from Run to Pipe, goes through the Executor, which makes it possible
+// to test magefiles without running real commands (see the shtest package).
+//
+// Run runs the command, and returns nil if it succeeded. If the command ran but
+// failed, the error should implement ExitStatus() int to report its exit code,
+// like the errors from os/exec do. Run should stop the command when ctx is
+// done.
+type Executor interface {
+	Run(ctx context.Context, inv *Invocation) error
+}
+
+// PathFinder is implemented by Executors that can tell whether a command is
+// installed, which Require uses to look for tools. Require looks for the tools
+// of Executors that don't implement it on the PATH.
+type PathFinder interface {
+	// LookPath returns the path of the command name, which Require then runs
+	// to check its version, or an error if it isn't installed.
+	LookPath(name string) (string, error)
+}
+
+// OSExecutor is the Executor used by default, which runs commands as child
+// processes with os/exec.
+type OSExecutor struct{}
+
+// Run implements Executor. If ctx can be done, the command is stopped as
+// described for ExecCtx.
+func (OSExecutor) Run(ctx context.Context, inv *Invocation) error {
+	c := exec.CommandContext(ctx, inv.Name, inv.Args...)
+	// done stops what terminate left pending once the command has been waited
+	// for. Wait only returns after Cancel has, so it's set by then.
+	var done func()
+	if ctx.Done() != nil {
+		grace := mg.GracePeriod()
+		setProcessGroup(c)
+		cancel := func(grace time.Duration) (err error) {
+			done, err = terminate(c.Process, grace)
+			return err
+		}
+		if stop, ok := ctx.Value(stopGraceKey{}).(*atomic.Pointer[time.Duration]); ok {
+			// a process started with Start may be stopped with any grace
+			// period. Its WaitDelay, which also bounds how long Wait waits
+			// for processes it left behind holding its output open, is
+			// raised to that grace period by Cancel, which os/exec calls
+			// before reading it.
+			c.Cancel = func() error {
+				if d := stop.Load(); d != nil {
+					if *d > 0 {
+						c.WaitDelay = *d
+					}
+					return cancel(*d)
+				}
+				return cancel(grace)
+			}
+			c.WaitDelay = grace
+		} else {
+			c.Cancel = func() error { return cancel(grace) }
+			c.WaitDelay = grace
+		}
+	}
+	// a nil Env would mean this process's environment to os/exec.
+	c.Env = []string{}
+	if !inv.ClearEnv {
+		c.Env = os.Environ()
+	}
+	for k, v := range inv.Env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	c.Dir = inv.Dir
+	c.Stdin = inv.Stdin
+	c.Stdout = inv.Stdout
+	c.Stderr = inv.Stderr
+	err := c.Run()
+	if done != nil {
+		done()
+	}
+	return err
+}
+
+// LookPath implements PathFinder by searching the PATH, like exec.LookPath.
+func (OSExecutor) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// lookPath finds the command name with e, or on the PATH if e can't.
+func lookPath(e Executor, name string) (string, error) {
+	if f, ok := e.(PathFinder); ok {
+		return f.LookPath(name)
+	}
+	return exec.LookPath(name)
+}
+
+type executorKey struct{}
+
+// stopGraceKey is the key of the grace period that Process.Stop sets, in the
+// context of the command it stops.
+type stopGraceKey struct{}
+
+// WithExecutor returns a context that makes the commands run with it, e.g. by
+// RunCtx or Command(...).Run(ctx), use e. Commands run without a context, like
+// Run, use e too if they are run by a dependency that was passed the context,
+// e.g. by mg.CtxDeps. This scopes e to the code the context is passed to, so
+// tests using different executors can run in parallel.
+func WithExecutor(ctx context.Context, e Executor) context.Context {
+	return context.WithValue(ctx, executorKey{}, e)
+}
+
+var defaultExecutor = struct {
+	mu sync.Mutex
+	e  Executor
+}{e: OSExecutor{}}
+
+// SetExecutor makes e the Executor for every command run with a context that
+// doesn't have one set with WithExecutor, including commands run without a
+// context, like Run. It returns a function that restores the previous
+// Executor:
+//
+//	defer sh.SetExecutor(fake)()
+//
+// Since this affects the whole process, tests that use it can't run in
+// parallel.
+func SetExecutor(e Executor) (restore func()) {
+	defaultExecutor.mu.Lock()
+	defer defaultExecutor.mu.Unlock()
+	prev := defaultExecutor.e
+	defaultExecutor.e = e
+	return func() {
+		defaultExecutor.mu.Lock()
+		defer defaultExecutor.mu.Unlock()
+		defaultExecutor.e = prev
+	}
+}
+
+// executorFor returns the Executor for commands run with ctx.
+func executorFor(ctx context.Context) Executor {
+	if e, ok := ctx.Value(executorKey{}).(Executor); ok {
+		return e
+	}
+	// commands run without a context, like Run, use the executor of the
+	// dependency running them, if it was given one.
+	if e, ok := mg.Context().Value(executorKey{}).(Executor); ok {
+		return e
+	}
+	defaultExecutor.mu.Lock()
+	defer defaultExecutor.mu.Unlock()
+	return defaultExecutor.e
+}
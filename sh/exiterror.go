@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// StderrTailSize is how much of the end of a command's stderr an ExitError
+// keeps.
+const StderrTailSize = 4 << 10
+
+// ExitError is returned by Exec and the functions built on it when a command
+// ran but exited with a non-zero code. Besides the exit code, which mage exits
+// with if the error is returned from a target, it keeps the end of what the
+// command wrote to stderr, which mage prints under the error, so that the
+// actual failure doesn't have to be dug out of the log.
+type ExitError struct {
+	Name     string        // the command, after expanding environment variables
+	Args     []string      // the arguments, after expanding environment variables
+	Dir      string        // the working directory, or "" for the current one
+	Code     int           // the exit code
+	Duration time.Duration // how long the command ran
+
+	// Stderr is the last StderrTailSize bytes the command wrote to stderr,
+	// which is truncated if StderrTruncated is true.
+	Stderr          []byte
+	StderrTruncated bool
+
+	// Err is the error of the Executor that ran the command, usually an
+	// *exec.ExitError.
+	Err error
+}
+
+// Error returns a message with the command and its exit code. Secrets (see
+// RegisterSecret) are redacted.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf(`running "%s" failed with exit code %d`, e.CommandLine(), e.Code)
+}
+
+// Unwrap returns the error of the Executor.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitStatus returns the exit code of the command.
+func (e *ExitError) ExitStatus() int {
+	return e.Code
+}
+
+// CommandLine returns the command and its arguments, separated by spaces, with
+// secrets redacted.
+func (e *ExitError) CommandLine() string {
+	return mg.Redact(strings.TrimSpace(e.Name + " " + strings.Join(e.Args, " ")))
+}
+
+// StderrTail returns the end of the command's stderr with secrets redacted. If
+// it was truncated, the first, partial line is replaced with "...".
+func (e *ExitError) StderrTail() string {
+	b := bytes.TrimRight(e.Stderr, "\n")
+	if e.StderrTruncated {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+		b = append([]byte("...\n"), b...)
+	}
+	return mg.Redact(string(b))
+}
+
+// tailBuffer keeps the last size bytes written to it.
+type tailBuffer struct {
+	size      int
+	buf       []byte
+	truncated bool
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	if over := len(t.buf) - t.size; over > 0 {
+		n := copy(t.buf, t.buf[over:])
+		t.buf = t.buf[:n]
+		t.truncated = true
+	}
+	return len(b), nil
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// Cmd returns a Builder for running cmd with the given arguments. It is the
+// same as Command, with a name that reads better as a stage of Pipe.
+func Cmd(cmd string, args ...string) *Builder {
+	return Command(cmd, args...)
+}
+
+// Pipeline is a series of commands, each reading what the one before it
+// writes to stdout. Create one with Pipe.
+type Pipeline struct {
+	stages []*Builder
+	stdout io.Writer
+}
+
+// Pipe connects the stdout of each command to the stdin of the next, like a
+// shell pipeline, without running a shell:
+//
+//	out, err := sh.Pipe(
+//		sh.Cmd("go", "list", "./..."),
+//		sh.Cmd("grep", "-v", "e2e"),
+//	).Lines(ctx)
+//
+// Each stage is set up and run like its Builder would be run on its own,
+// except that the stdin of every stage but the first is the pipe from the
+// stage before it. All stages run at the same time.
+//
+// The pipeline fails if any of its stages fails, like a shell pipeline with
+// pipefail set. The error is a *PipeError for the first failed stage, so its
+// exit code becomes mage's exit code. A stage that was killed by SIGPIPE
+// because a later stage failed doesn't count as the first.
+func Pipe(stages ...*Builder) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Stdout streams the output of the last stage to w while the pipeline is run
+// with Run, rather than to this process's stdout.
+func (p *Pipeline) Stdout(w io.Writer) *Pipeline {
+	p.stdout = w
+	return p
+}
+
+// Run runs the pipeline. The output of the last stage goes to the writer set
+// with Stdout or, if there is none, to this process's stdout if mage was run
+// with -v.
+func (p *Pipeline) Run(ctx context.Context) error {
+	stdout := p.stdout
+	if stdout == nil && mg.Verbose() {
+		stdout = os.Stdout
+	}
+	return p.exec(ctx, stdout)
+}
+
+// Output runs the pipeline and returns what the last stage wrote to stdout,
+// without the trailing newline.
+func (p *Pipeline) Output(ctx context.Context) (string, error) {
+	buf := &bytes.Buffer{}
+	err := p.exec(ctx, buf)
+	return strings.TrimSuffix(buf.String(), "\n"), err
+}
+
+// Lines runs the pipeline and returns what the last stage wrote to stdout,
+// split into lines.
+func (p *Pipeline) Lines(ctx context.Context) ([]string, error) {
+	out, err := p.Output(ctx)
+	return splitLines(out), err
+}
+
+func (p *Pipeline) exec(ctx context.Context, stdout io.Writer) error {
+	n := len(p.stages)
+	if n == 0 {
+		return errors.New("can't run an empty pipeline")
+	}
+
+	// create every pipe before starting anything, so that a failure doesn't
+	// leave a stage waiting on a pipe no one writes to.
+	readers := make([]*os.File, n)
+	writers := make([]*os.File, n)
+	for i := 0; i < n-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeAll(readers)
+			closeAll(writers)
+			return fmt.Errorf("can't create pipe: %v", err)
+		}
+		readers[i+1], writers[i] = r, w
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, b := range p.stages {
+		var in io.Reader = b.cmd.Stdin
+		if readers[i] != nil {
+			in = readers[i]
+		}
+		var out io.Writer = stdout
+		if writers[i] != nil {
+			out = writers[i]
+		}
+		wg.Add(1)
+		go func(i int, b *Builder, in io.Reader, out io.Writer) {
+			defer wg.Done()
+			errs[i] = b.exec(ctx, in, out, os.Stderr)
+			// once a stage is done, the stage after it sees the end of its
+			// input, and the stage before it can't write anymore.
+			if writers[i] != nil {
+				writers[i].Close()
+			}
+			if readers[i] != nil {
+				readers[i].Close()
+			}
+		}(i, b, in, out)
+	}
+	wg.Wait()
+
+	// a stage that was killed for writing to a stage that failed isn't the
+	// cause of the failure.
+	failed := -1
+	for i := n - 1; i >= 0; i-- {
+		if errs[i] != nil && (failed < 0 || !brokenPipe(errs[i])) {
+			failed = i
+		}
+	}
+	if failed < 0 {
+		return nil
+	}
+	return &PipeError{Stage: failed, Stages: n, Err: errs[failed]}
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// PipeError is returned when a stage of a Pipeline fails.
+type PipeError struct {
+	Stage  int   // index of the failed stage, starting at 0
+	Stages int   // number of stages in the pipeline
+	Err    error // error of the failed stage
+}
+
+func (e *PipeError) Error() string {
+	return fmt.Sprintf("stage %d of %d of pipeline failed: %v", e.Stage+1, e.Stages, e.Err)
+}
+
+func (e *PipeError) Unwrap() error {
+	return e.Err
+}
+
+// ExitStatus returns the exit status of the failed stage, so that a failed
+// pipeline fails mage with the same code.
+func (e *PipeError) ExitStatus() int {
+	return ExitStatus(e.Err)
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	ctx := context.Background()
+	lines, err := Pipe(
+		Cmd(os.Args[0], "-cat").Stdin(strings.NewReader("one\ntwo\n")),
+		Cmd(os.Args[0], "-cat"),
+		Cmd(os.Args[0], "-cat"),
+	).Lines(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected %q, got %q", want, lines)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Pipe(
+		Cmd(os.Args[0], "-helper", "-stdout", "hello").Quiet(),
+		Cmd(os.Args[0], "-cat"),
+	).Stdout(buf).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello\n" {
+		t.Fatalf("expected the output to be streamed to the writer, got %q", buf)
+	}
+}
+
+func TestPipeFailure(t *testing.T) {
+	ctx := context.Background()
+	_, err := Pipe(
+		Cmd(os.Args[0], "-helper", "-exit", "3").Quiet(),
+		Cmd(os.Args[0], "-cat"),
+	).Output(ctx)
+	var pe *PipeError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *PipeError, got %#v", err)
+	}
+	if pe.Stage != 0 || pe.Stages != 2 {
+		t.Fatalf("expected the first of 2 stages to fail, got stage %d of %d", pe.Stage, pe.Stages)
+	}
+	if ExitStatus(err) != 3 {
+		t.Fatalf("expected exit status 3, got %d", ExitStatus(err))
+	}
+	if !CmdRan(err) {
+		t.Fatal("expected CmdRan to report that a stage that exited with an error ran")
+	}
+	if !strings.Contains(err.Error(), "stage 1 of 2") {
+		t.Fatalf("expected the error to name the failed stage, got %q", err)
+	}
+
+	_, err = Pipe(
+		Cmd(os.Args[0], "-cat").Stdin(strings.NewReader("in")),
+		Cmd("thiswontwork"),
+	).Output(ctx)
+	if !errors.As(err, &pe) || pe.Stage != 1 {
+		t.Fatalf("expected the second stage to fail, got %v", err)
+	}
+	if ExitStatus(err) != 1 {
+		t.Fatalf("expected exit status 1 for a command that didn't run, got %d", ExitStatus(err))
+	}
+	if CmdRan(err) {
+		t.Fatal("expected CmdRan to report that a stage that doesn't exist didn't run")
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+//go:build !windows
+// +build !windows
+
+package sh
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts the command in a new process group, whose ID is the
+// pid of the command, so that it can be signalled with everything it starts.
+func setProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+}
+
+// terminate sends SIGTERM to the process group of p, and SIGKILL once grace has
+// passed. It returns a function to call once p has been waited for, which
+// stops the pending SIGKILL, since p's pid, and so the group's ID, may be
+// reused from then on. Anything left in the group by then is killed right
+// away, so that no stragglers are left.
+func terminate(p *os.Process, grace time.Duration) (func(), error) {
+	pgid := p.Pid
+	if grace <= 0 {
+		return func() {}, signalGroup(pgid, syscall.SIGKILL)
+	}
+	timer := time.AfterFunc(grace, func() {
+		_ = signalGroup(pgid, syscall.SIGKILL)
+	})
+	done := func() {
+		if timer.Stop() && syscall.Kill(-pgid, 0) == nil {
+			_ = signalGroup(pgid, syscall.SIGKILL)
+		}
+	}
+	return done, signalGroup(pgid, syscall.SIGTERM)
+}
+
+// brokenPipe reports whether err is from a command that was killed by SIGPIPE,
+// because it wrote to a pipe no one was reading anymore.
+func brokenPipe(err error) bool {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return false
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == syscall.SIGPIPE
+}
+
+// signalled, if set, is told of every signal sent to a process group, so that
+// tests can check which were.
+var signalled atomic.Pointer[func(pgid int, sig syscall.Signal)]
+
+func signalGroup(pgid int, sig syscall.Signal) error {
+	if f := signalled.Load(); f != nil {
+		(*f)(pgid, sig)
+	}
+	err := syscall.Kill(-pgid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// crossDevice reports whether err is a rename failing because the source and
+// destination are on different filesystems.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+//go:build !windows
+// +build !windows
+
+package sh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+func TestExecCtxNoKillAfterExit(t *testing.T) {
+	var mu sync.Mutex
+	var sent []syscall.Signal
+	record := func(pgid int, sig syscall.Signal) {
+		mu.Lock()
+		sent = append(sent, sig)
+		mu.Unlock()
+	}
+	signalled.Store(&record)
+	defer signalled.Store(nil)
+	t.Setenv(mg.GracePeriodEnv, "200ms")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the helper exits on SIGTERM, well within the grace period.
+	_, err := ExecCtx(ctx, nil, nil, nil, os.Args[0], "-helper", "-sleep", "1m")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []syscall.Signal{syscall.SIGTERM}; !reflect.DeepEqual(sent, want) {
+		t.Fatalf("expected only %v to be sent to a command that exited on it, got %v", want, sent)
+	}
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+//go:build windows
+// +build windows
+
+package sh
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup does nothing on Windows, which has no process groups that
+// can be signalled.
+func setProcessGroup(c *exec.Cmd) {}
+
+// terminate kills p right away, since Windows has no equivalent of SIGTERM,
+// so there is nothing left to do once p has been waited for.
+func terminate(p *os.Process, grace time.Duration) (func(), error) {
+	return func() {}, p.Kill()
+}
+
+// brokenPipe always reports false on Windows, which has no SIGPIPE.
+func brokenPipe(err error) bool {
+	return false
+}
+
+// crossDevice reports whether err is a rename failing because the source and
+// destination are on different drives.
+func crossDevice(err error) bool {
+	const errorNotSameDevice = syscall.Errno(17)
+	return errors.Is(err, errorNotSameDevice)
+}
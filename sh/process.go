@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// errStopped is the cause of the cancellation of a process stopped with Stop.
+var errStopped = errors.New("stopped")
+
+// pollInterval is how often the Wait methods of Process check whether the
+// process is ready.
+const pollInterval = 50 * time.Millisecond
+
+// Process is a command running in the background, started with Start.
+type Process struct {
+	cmdline string
+	cancel  context.CancelCauseFunc
+	grace   atomic.Pointer[time.Duration]
+	output  *outputLog
+	done    chan struct{}
+	err     error // set before done is closed
+}
+
+// Start starts a command in the background, e.g. a server that integration
+// tests run against, and returns right away:
+//
+//	srv := sh.Start(ctx, "./bin/server", "-port", "8080")
+//	defer srv.Stop(5 * time.Second)
+//	if err := srv.WaitForPort(ctx, "localhost:8080"); err != nil {
+//		return err
+//	}
+//
+// The command is run like RunCtx runs it, except that it doesn't read stdin:
+// environment variables in $FOO format are expanded, its stdout goes to this
+// process's stdout if mage was run with -v, and its stderr goes to this
+// process's stderr. It is stopped like ExecCtx stops commands when ctx is done,
+// and when the compiled magefile exits (see mg.AtExit), so that it doesn't
+// outlive mage. Processes it leaves behind when it exits are given the grace
+// period to close its output before the Process is done. Whether it failed to
+// run or failed later on, the error is reported by the methods of the Process.
+func Start(ctx context.Context, cmd string, args ...string) *Process {
+	var stdout io.Writer
+	if mg.Verbose() {
+		stdout = os.Stdout
+	}
+	inv := &Invocation{Name: cmd, Args: args, Stdout: stdout, Stderr: os.Stderr}
+	expandInvocation(inv)
+
+	p := &Process{
+		cmdline: mg.Redact(strings.Join(append([]string{inv.Name}, inv.Args...), " ")),
+		output:  newOutputLog(),
+		done:    make(chan struct{}),
+	}
+	ctx, p.cancel = context.WithCancelCause(context.WithValue(ctx, stopGraceKey{}, &p.grace))
+	running.add(p)
+	go func() {
+		defer close(p.done)
+		defer running.remove(p)
+		defer p.cancel(nil)
+		stdout, stderr := p.output.writer(), p.output.writer()
+		_, p.err = executeTapped(ctx, inv, tap{stdout: stdout, stderr: stderr})
+		// a last line without a line ending is only complete now.
+		stdout.flush()
+		stderr.flush()
+	}()
+	return p
+}
+
+// running holds the processes started with Start that haven't exited yet.
+var running processSet
+
+// processSet is a set of running processes, which are stopped when the
+// compiled magefile exits. A single exit hook stops them all, so that
+// processes that already exited don't stay registered until then.
+type processSet struct {
+	mu    sync.Mutex
+	once  sync.Once
+	procs []*Process
+}
+
+func (s *processSet) add(p *Process) {
+	s.once.Do(func() { mg.AtExit(s.stopAll) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.procs = append(s.procs, p)
+}
+
+func (s *processSet) remove(p *Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, q := range s.procs {
+		if q == p {
+			s.procs = append(s.procs[:i], s.procs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *processSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.procs)
+}
+
+// stopAll stops the processes, the most recently started first.
+func (s *processSet) stopAll() {
+	s.mu.Lock()
+	procs := append([]*Process(nil), s.procs...)
+	s.mu.Unlock()
+	for i := len(procs) - 1; i >= 0; i-- {
+		procs[i].Stop(mg.GracePeriod())
+	}
+}
+
+// String returns the command line of the process.
+func (p *Process) String() string {
+	return p.cmdline
+}
+
+// Stop stops the process, if it's still running, and waits for it to exit.
+// The process and the processes it started are sent SIGTERM, and whatever is
+// still running after the grace period is sent SIGKILL. On Windows, the
+// process is killed right away. Stop returns what Wait returns.
+func (p *Process) Stop(grace time.Duration) error {
+	p.grace.Store(&grace)
+	p.cancel(errStopped)
+	return p.Wait()
+}
+
+// Wait waits for the process to exit. It returns nil if the process exited
+// successfully or was stopped with Stop, and otherwise an error like the one
+// ExecCtx would return, e.g. an *ExitError.
+func (p *Process) Wait() error {
+	<-p.done
+	if errors.Is(p.err, errStopped) {
+		return nil
+	}
+	return p.err
+}
+
+// Exited returns a channel that is closed once the process has exited.
+func (p *Process) Exited() <-chan struct{} {
+	return p.done
+}
+
+// WaitForPort waits until a TCP connection to addr, e.g. "localhost:8080", can
+// be opened. It returns an error if the process exits first or ctx is done.
+func (p *Process) WaitForPort(ctx context.Context, addr string) error {
+	var d net.Dialer
+	return p.poll(ctx, "listening on "+addr, func() bool {
+		dctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		conn, err := d.DialContext(dctx, "tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	})
+}
+
+// WaitForFile waits until the file at path exists. It returns an error if the
+// process exits first or ctx is done.
+func (p *Process) WaitForFile(ctx context.Context, path string) error {
+	return p.poll(ctx, "creating "+path, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+}
+
+// WaitForOutput waits until the process writes a line to stdout or stderr that
+// matches re, and returns the line, without its line ending. Lines written
+// before WaitForOutput was called count too. It returns an error if the
+// process exits first or ctx is done.
+func (p *Process) WaitForOutput(ctx context.Context, re *regexp.Regexp) (string, error) {
+	next := 0
+	for {
+		line, n, changed := p.output.find(re, next)
+		if n < 0 {
+			return line, nil
+		}
+		next = n
+		select {
+		case <-changed:
+		case <-p.done:
+			// the output is complete once the process is done.
+			if line, n, _ := p.output.find(re, next); n < 0 {
+				return line, nil
+			}
+			return "", p.exitedBefore(fmt.Sprintf("writing a line matching %q", re))
+		case <-ctx.Done():
+			return "", fmt.Errorf("waiting for %s to write a line matching %q: %w", p, re, context.Cause(ctx))
+		}
+	}
+}
+
+// poll calls ready until it reports true, the process exits or ctx is done.
+func (p *Process) poll(ctx context.Context, what string, ready func() bool) error {
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+	for {
+		if ready() {
+			return nil
+		}
+		select {
+		case <-tick.C:
+		case <-p.done:
+			if ready() {
+				return nil
+			}
+			return p.exitedBefore(what)
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s to start %s: %w", p, what, context.Cause(ctx))
+		}
+	}
+}
+
+// exitedBefore returns the error for a process that exited before it was
+// ready.
+func (p *Process) exitedBefore(what string) error {
+	if err := p.Wait(); err != nil {
+		return fmt.Errorf("%s exited before %s: %w", p, what, err)
+	}
+	return fmt.Errorf("%s exited before %s", p, what)
+}
+
+// outputLog keeps the most recent lines a process wrote to stdout and stderr,
+// for WaitForOutput.
+type outputLog struct {
+	mu      sync.Mutex
+	lines   []string
+	first   int // number of lines dropped from the start of lines
+	size    int // total length of lines
+	changed chan struct{}
+}
+
+// maxOutputLog is how much output an outputLog keeps.
+const maxOutputLog = 1 << 20
+
+func newOutputLog() *outputLog {
+	return &outputLog{changed: make(chan struct{})}
+}
+
+// writer returns a writer that adds the complete lines written to it to the
+// log. Each stream needs its own writer, so that lines from different streams
+// aren't mixed up.
+func (l *outputLog) writer() *lineWriter {
+	return &lineWriter{fn: l.add}
+}
+
+func (l *outputLog) add(line string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+	l.size += len(line)
+	for l.size > maxOutputLog && len(l.lines) > 1 {
+		l.size -= len(l.lines[0])
+		l.lines = l.lines[1:]
+		l.first++
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return nil
+}
+
+// find looks for a line matching re, starting at line number next. If it
+// finds one, it returns the line and -1. Otherwise it returns the number of
+// the next line to look at, and a channel that is closed when a line is added.
+func (l *outputLog) find(re *regexp.Regexp, next int) (string, int, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if next < l.first {
+		next = l.first
+	}
+	for ; next < l.first+len(l.lines); next++ {
+		if line := l.lines[next-l.first]; re.MatchString(line) {
+			return line, -1, nil
+		}
+	}
+	return "", next, l.changed
+}
+
+// lineWriter calls fn with each complete line written to it, without its line
+// ending. If fn returns an error, Write returns it.
+type lineWriter struct {
+	fn  func(line string) error
+	buf []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		if err := w.fn(line); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// flush calls fn with the last line, if it has no line ending.
+func (w *lineWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := string(w.buf)
+	w.buf = nil
+	return w.fn(line)
+}
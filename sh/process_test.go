@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+func TestStart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := Start(ctx, os.Args[0], "-helper", "-listen", "-sleep", "1m")
+	line, err := p.WaitForOutput(ctx, regexp.MustCompile(`^listening on \S+$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := strings.TrimPrefix(line, "listening on ")
+	if err := p.WaitForPort(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Exited():
+		t.Fatal("expected the process to still be running")
+	default:
+	}
+	if err := p.Stop(100 * time.Millisecond); err != nil {
+		t.Fatalf("expected a stopped process to report no error, got %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("expected a stopped process to report no error, got %v", err)
+	}
+	if n := running.len(); n != 0 {
+		t.Fatalf("expected processes that exited not to be kept for the exit hook, got %d", n)
+	}
+}
+
+func TestStartLastLine(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p := Start(ctx, os.Args[0], "-helper", "-partial", "listening on :8080")
+	line, err := p.WaitForOutput(ctx, regexp.MustCompile(`^listening on :8080$`))
+	if err != nil {
+		t.Fatalf("expected a last line without a line ending to be found, got %v", err)
+	}
+	if line != "listening on :8080" {
+		t.Fatalf("expected the last line, got %q", line)
+	}
+}
+
+func TestStartLeftBehind(t *testing.T) {
+	t.Setenv(mg.GracePeriodEnv, "200ms")
+	// the process exits right away, but leaves one behind that holds its
+	// output open.
+	p := Start(context.Background(), os.Args[0], "-helper", "-orphan", "5s")
+	select {
+	case <-p.Exited():
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the process to be done once the grace period passed")
+	}
+}
+
+func TestStartWaitForFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ready")
+	p := Start(ctx, os.Args[0], "-helper", "-touch", path, "-sleep", "1m")
+	defer p.Stop(0)
+	if err := p.WaitForFile(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartExited(t *testing.T) {
+	ctx := context.Background()
+	p := Start(ctx, os.Args[0], "-helper", "-exit", "3")
+	_, err := p.WaitForOutput(ctx, regexp.MustCompile("never"))
+	var ee *ExitError
+	if !errors.As(err, &ee) || ee.Code != 3 {
+		t.Fatalf("expected an error with exit code 3, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "exited before writing a line") {
+		t.Fatalf("expected the error to say the process exited, got %q", err)
+	}
+	if ExitStatus(p.Stop(0)) != 3 {
+		t.Fatalf("expected Stop to report the earlier failure, got %v", p.Wait())
+	}
+}
+
+func TestStartCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Start(ctx, os.Args[0], "-helper", "-sleep", "1m")
+	cancel()
+	select {
+	case <-p.Exited():
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the process to be stopped when its context is done")
+	}
+	if err := p.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelWait()
+	p = Start(context.Background(), os.Args[0], "-helper", "-sleep", "1m")
+	defer p.Stop(0)
+	if err := p.WaitForFile(waitCtx, filepath.Join(t.TempDir(), "never")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected waiting to time out, got %v", err)
+	}
+}
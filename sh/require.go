@@ -0,0 +1,349 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tool describes how Require checks a tool.
+type Tool struct {
+	// VersionArgs are the arguments that make the tool print its version. They
+	// default to "--version".
+	VersionArgs []string
+
+	// Hint tells the user how to install the tool, e.g. a download URL. It is
+	// included in the error for a tool that is missing or has the wrong
+	// version.
+	Hint string
+}
+
+// tools holds the tools registered with RegisterTool, and some common ones.
+var tools = struct {
+	mu sync.Mutex
+	m  map[string]Tool
+}{m: map[string]Tool{
+	"docker": {Hint: "https://docs.docker.com/get-docker/"},
+	"git":    {Hint: "https://git-scm.com/downloads"},
+	"go":     {VersionArgs: []string{"version"}, Hint: "https://go.dev/dl/"},
+	"java":   {VersionArgs: []string{"-version"}, Hint: "https://adoptium.net/"},
+	"node":   {Hint: "https://nodejs.org/en/download"},
+	"npm":    {Hint: "https://nodejs.org/en/download"},
+	"protoc": {Hint: "https://github.com/protocolbuffers/protobuf/releases"},
+	"python": {Hint: "https://www.python.org/downloads/"},
+}}
+
+// RegisterTool sets how Require checks the tool with the given name, replacing
+// the defaults for it, if any.
+func RegisterTool(name string, t Tool) {
+	tools.mu.Lock()
+	defer tools.mu.Unlock()
+	tools.m[name] = t
+}
+
+func toolFor(name string) Tool {
+	tools.mu.Lock()
+	defer tools.mu.Unlock()
+	t := tools.m[name]
+	if len(t.VersionArgs) == 0 {
+		t.VersionArgs = []string{"--version"}
+	}
+	return t
+}
+
+// probes caches the versions reported by tools run with OSExecutor, by path,
+// so that targets requiring the same tool don't run it again.
+var probes = struct {
+	mu sync.Mutex
+	m  map[string]string
+}{m: map[string]string{}}
+
+// Require checks that the given tools are installed, so that a target can fail
+// right away, rather than halfway through, when one is missing:
+//
+//	if err := sh.Require("protoc >= 3.21", "docker", "node ^18"); err != nil {
+//		return err
+//	}
+//
+// Each requirement is the name of a tool, followed by any number of version
+// constraints that all have to hold. A constraint is an operator, one of =, >,
+// >=, <, <=, ^ and ~, followed by a version, like "1.2.3", "1.2" or "1". The
+// operators ^ and ~ work like in npm: "^1.2" allows 1.2 up to but excluding 2,
+// and "~1.2" allows 1.2 up to but excluding 1.3. A version without an operator
+// must match as far as it goes, so "18" allows any 18.x.y.
+//
+// Require looks for each tool on the PATH and, if there are constraints, runs
+// it to find out its version (see RegisterTool), which is the first thing that
+// looks like a version in its output. It returns a *RequireError that lists
+// every tool that is missing or has the wrong version, with a hint on how to
+// install it.
+//
+// Tools are looked for and run with the Executor that commands run without a
+// context use, so that a fake one can stand in for the system, as long as it
+// implements PathFinder.
+func Require(requirements ...string) error {
+	var reqs []requirement
+	for _, s := range requirements {
+		r, err := parseRequirement(s)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, r)
+	}
+	ex := executorFor(context.Background())
+	e := &RequireError{}
+	for _, r := range reqs {
+		if problem := r.check(ex); problem != "" {
+			e.Problems = append(e.Problems, ToolProblem{
+				Requirement: r.text,
+				Problem:     problem,
+				Hint:        toolFor(r.name).Hint,
+			})
+		}
+	}
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+// RequireError is returned by Require when tools are missing or have the wrong
+// version.
+type RequireError struct {
+	Problems []ToolProblem
+}
+
+// ToolProblem is a requirement that isn't met.
+type ToolProblem struct {
+	Requirement string // as passed to Require
+	Problem     string // e.g. "not found on the PATH"
+	Hint        string // how to install the tool, if known
+}
+
+// Error lists the problems, one per line.
+func (e *RequireError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("a required tool isn't available:")
+	} else {
+		fmt.Fprintf(&b, "%d required tools aren't available:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Requirement, p.Problem)
+		if p.Hint != "" {
+			fmt.Fprintf(&b, " (install from %s)", p.Hint)
+		}
+	}
+	return b.String()
+}
+
+type requirement struct {
+	text        string
+	name        string
+	constraints []constraint
+}
+
+func parseRequirement(s string) (requirement, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return requirement{}, fmt.Errorf("empty tool requirement")
+	}
+	r := requirement{text: strings.Join(fields, " "), name: fields[0]}
+	// allow a space between an operator and its version, as in "protoc >= 3.21".
+	var pending string
+	for _, f := range fields[1:] {
+		if strings.Trim(f, "=<>^~") == "" {
+			pending += f
+			continue
+		}
+		c, err := parseConstraint(pending + f)
+		if err != nil {
+			return requirement{}, fmt.Errorf("bad tool requirement %q: %v", s, err)
+		}
+		r.constraints = append(r.constraints, c)
+		pending = ""
+	}
+	if pending != "" {
+		return requirement{}, fmt.Errorf("bad tool requirement %q: %s without a version", s, pending)
+	}
+	return r, nil
+}
+
+// check returns why the requirement isn't met with the tools of e, or "" if
+// it is.
+func (r requirement) check(e Executor) string {
+	path, err := lookPath(e, r.name)
+	if err != nil {
+		return "not found on the PATH"
+	}
+	if len(r.constraints) == 0 {
+		return ""
+	}
+	out, err := probeVersion(e, path, toolFor(r.name).VersionArgs)
+	v, ok := findVersion(out)
+	if !ok {
+		if err != nil {
+			return fmt.Sprintf("can't determine its version: %v", err)
+		}
+		return fmt.Sprintf("can't determine its version from %q", firstLine(out))
+	}
+	for _, c := range r.constraints {
+		if !c.allows(v) {
+			return fmt.Sprintf("version %s is installed", v)
+		}
+	}
+	return ""
+}
+
+// probeVersion runs the tool at path with args with e, and returns what it
+// wrote to stdout and stderr, since some tools print their version to stderr.
+func probeVersion(e Executor, path string, args []string) (string, error) {
+	_, cache := e.(OSExecutor)
+	key := path + "\x00" + strings.Join(args, "\x00")
+	if cache {
+		probes.mu.Lock()
+		out, ok := probes.m[key]
+		probes.mu.Unlock()
+		if ok {
+			return out, nil
+		}
+	}
+	ctx := WithExecutor(context.Background(), e)
+	out, err := Command(path, args...).Stdin(nil).Timeout(30 * time.Second).Quiet().CombinedOutput(ctx)
+	if err == nil && cache {
+		probes.mu.Lock()
+		probes.m[key] = out
+		probes.mu.Unlock()
+	}
+	return out, err
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line)
+}
+
+// version is a version with up to three numbers, of which n were given.
+type version struct {
+	parts [3]int
+	n     int
+}
+
+func (v version) String() string {
+	s := make([]string, v.n)
+	for i := range s {
+		s[i] = strconv.Itoa(v.parts[i])
+	}
+	return strings.Join(s, ".")
+}
+
+// compare compares the first n numbers of v and w.
+func (v version) compare(w version, n int) int {
+	for i := 0; i < n; i++ {
+		if v.parts[i] != w.parts[i] {
+			if v.parts[i] < w.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+var (
+	versionRe     = regexp.MustCompile(`\d+(\.\d+){0,2}`)
+	toolVersionRe = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+)
+
+func parseVersion(s string) (version, error) {
+	s = strings.TrimPrefix(s, "v")
+	if versionRe.FindString(s) != s {
+		return version{}, fmt.Errorf("bad version %q", s)
+	}
+	var v version
+	for i, p := range strings.Split(s, ".") {
+		v.parts[i], _ = strconv.Atoi(p)
+		v.n++
+	}
+	return v, nil
+}
+
+// findVersion returns the first version in the output of a tool. Versions with
+// at least two numbers are preferred, so that "go1.21.3" isn't taken for 1.
+func findVersion(out string) (version, bool) {
+	s := toolVersionRe.FindString(out)
+	if s == "" {
+		s = versionRe.FindString(out)
+	}
+	if s == "" {
+		return version{}, false
+	}
+	v, err := parseVersion(s)
+	return v, err == nil
+}
+
+type constraint struct {
+	op string
+	v  version
+}
+
+func parseConstraint(s string) (constraint, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !strings.ContainsRune("=<>^~", r) })
+	if i < 0 {
+		return constraint{}, fmt.Errorf("%s without a version", s)
+	}
+	c := constraint{op: s[:i]}
+	switch c.op {
+	case "", "=", ">", ">=", "<", "<=", "^", "~":
+	default:
+		return constraint{}, fmt.Errorf("unknown operator %q", c.op)
+	}
+	v, err := parseVersion(s[i:])
+	if err != nil {
+		return constraint{}, err
+	}
+	c.v = v
+	return c, nil
+}
+
+// allows reports whether v meets the constraint. Numbers missing from either
+// version count as 0, except that = only compares the numbers it was given.
+func (c constraint) allows(v version) bool {
+	switch c.op {
+	case "", "=":
+		return v.compare(c.v, c.v.n) == 0
+	case ">":
+		return v.compare(c.v, 3) > 0
+	case ">=":
+		return v.compare(c.v, 3) >= 0
+	case "<":
+		return v.compare(c.v, 3) < 0
+	case "<=":
+		return v.compare(c.v, 3) <= 0
+	}
+	if v.compare(c.v, 3) < 0 {
+		return false
+	}
+	// ^ and ~ allow versions up to the next change of the number that is
+	// significant for them.
+	var upper version
+	upper.n = 3
+	switch {
+	case c.op == "~" && c.v.n >= 2:
+		upper.parts = [3]int{c.v.parts[0], c.v.parts[1] + 1, 0}
+	case c.op == "~" || c.v.parts[0] > 0 || c.v.n == 1:
+		upper.parts = [3]int{c.v.parts[0] + 1, 0, 0}
+	case c.v.parts[1] > 0 || c.v.n == 2:
+		upper.parts = [3]int{0, c.v.parts[1] + 1, 0}
+	default:
+		upper.parts = [3]int{0, 0, c.v.parts[2] + 1}
+	}
+	return v.compare(upper, 3) < 0
+}
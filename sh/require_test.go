@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		allowed    bool
+	}{
+		{">=3.21", "3.21.12", true},
+		{">=3.21", "3.20.3", false},
+		{">3.21", "3.21", false},
+		{"<2", "1.9.9", true},
+		{"<=1.2", "1.2.0", true},
+		{"18", "18.17.1", true},
+		{"=18", "19.0.0", false},
+		{"^18", "18.17.1", true},
+		{"^18", "19.0.0", false},
+		{"^0.5", "0.5.9", true},
+		{"^0.5", "0.6.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2", "1.2.9", true},
+		{"~1.2", "1.3.0", false},
+		{"~1", "1.9.0", true},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.constraint, err)
+		}
+		v, err := parseVersion(tt.version)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.version, err)
+		}
+		if got := c.allows(v); got != tt.allowed {
+			t.Errorf("expected %s allows %s to be %v, got %v", tt.constraint, tt.version, tt.allowed, got)
+		}
+	}
+}
+
+func TestFindVersion(t *testing.T) {
+	tests := map[string]string{
+		"go version go1.21.3 linux/amd64":         "1.21.3",
+		"Docker version 24.0.5, build ced0996":    "24.0.5",
+		"v18.17.1":                                "18.17.1",
+		"libprotoc 3.21.12":                       "3.21.12",
+		`openjdk version "17" 2021-09-14` + "\nx": "17",
+	}
+	for out, want := range tests {
+		v, ok := findVersion(out)
+		if !ok || v.String() != want {
+			t.Errorf("expected version %s in %q, got %v", want, out, v)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	RegisterTool(os.Args[0], Tool{
+		VersionArgs: []string{"-helper", "-stdout", "helper version 1.4.2"},
+		Hint:        "https://example.com/helper",
+	})
+	if err := Require(os.Args[0], os.Args[0]+" >= 1.4", os.Args[0]+" ^1 <2"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Require(os.Args[0]+" >= 2", "thiswontwork", "thiswontworkeither ^1")
+	var re *RequireError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected a *RequireError, got %v", err)
+	}
+	if len(re.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", re.Problems)
+	}
+	msg := err.Error()
+	for _, s := range []string{
+		"3 required tools aren't available:",
+		"version 1.4.2 is installed (install from https://example.com/helper)",
+		"thiswontwork: not found on the PATH",
+	} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("expected the error to contain %q, got %q", s, msg)
+		}
+	}
+
+	if err := Require("go >= "); err == nil || !strings.Contains(err.Error(), "without a version") {
+		t.Fatalf("expected an error for a bad requirement, got %v", err)
+	}
+}
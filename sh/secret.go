@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import "github.com/actualyze-ai/mage/mg"
+
+// RegisterSecret registers values as secrets (see mg.Secret), so that they are
+// redacted from the commands logged with -v, from the errors of commands that
+// fail, and from the output of commands if MAGEFILE_REDACT_OUTPUT is set.
+//
+// Values of environment variables whose names match the patterns in
+// MAGEFILE_REDACT_ENV, "*_TOKEN", "*_PASSWORD" and "*_SECRET" by default, are
+// redacted without being registered, including variables passed to commands,
+// e.g. with RunWith.
+func RegisterSecret(values ...string) {
+	for _, v := range values {
+		mg.Secret(v)
+	}
+}
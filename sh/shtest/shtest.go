@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+// Package shtest provides a fake sh.Executor, for testing magefiles without
+// running real commands. A Fake records the commands it is asked to run, and
+// answers them with the responses scripted for them:
+//
+//	func TestBuild(t *testing.T) {
+//		fake := shtest.New()
+//		fake.On("go", "build").Stdout("ok\n")
+//		if err := Build(fake.Context(context.Background())); err != nil {
+//			t.Fatal(err)
+//		}
+//		if got := fake.Commands(); !reflect.DeepEqual(got, []string{"go build ./..."}) {
+//			t.Fatalf("unexpected commands: %q", got)
+//		}
+//	}
+package shtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/actualyze-ai/mage/sh"
+)
+
+// Fake is an sh.Executor that records commands instead of running them. It is
+// safe for concurrent use.
+type Fake struct {
+	mu        sync.Mutex
+	responses []*Response
+	calls     []Call
+}
+
+// New returns a Fake with no responses scripted.
+func New() *Fake {
+	return &Fake{}
+}
+
+// Call is a command that was run with a Fake.
+type Call struct {
+	Name     string
+	Args     []string
+	Env      map[string]string
+	ClearEnv bool
+	Dir      string
+}
+
+// String returns the command line of the call, e.g. "go build ./...".
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Response is what a Fake answers a command with. By default the command
+// succeeds without output.
+type Response struct {
+	name   string
+	args   []string
+	stdout string
+	stderr string
+	code   int
+	err    error
+}
+
+// Stdout sets what the command writes to stdout.
+func (r *Response) Stdout(s string) *Response {
+	r.stdout = s
+	return r
+}
+
+// Stderr sets what the command writes to stderr.
+func (r *Response) Stderr(s string) *Response {
+	r.stderr = s
+	return r
+}
+
+// Exit makes the command exit with the given code.
+func (r *Response) Exit(code int) *Response {
+	r.code = code
+	return r
+}
+
+// Err makes the command fail to run with err, as if it wasn't installed.
+func (r *Response) Err(err error) *Response {
+	r.err = err
+	return r
+}
+
+// On scripts the response to commands named name whose arguments start with
+// args, so On("go") matches every go command. If more than one response
+// matches a command, the one scripted first is used. Commands without a
+// matching response fail to run.
+func (f *Fake) On(name string, args ...string) *Response {
+	r := &Response{name: name, args: args}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, r)
+	return r
+}
+
+// Run implements sh.Executor.
+func (f *Fake) Run(ctx context.Context, inv *sh.Invocation) error {
+	call := Call{
+		Name:     inv.Name,
+		Args:     append([]string(nil), inv.Args...),
+		ClearEnv: inv.ClearEnv,
+		Dir:      inv.Dir,
+	}
+	if len(inv.Env) > 0 {
+		call.Env = make(map[string]string, len(inv.Env))
+		for k, v := range inv.Env {
+			call.Env[k] = v
+		}
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	r := f.match(call)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("shtest: no response scripted for %q", call)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if inv.Stdout != nil {
+		if _, err := io.WriteString(inv.Stdout, r.stdout); err != nil {
+			return err
+		}
+	}
+	if inv.Stderr != nil {
+		if _, err := io.WriteString(inv.Stderr, r.stderr); err != nil {
+			return err
+		}
+	}
+	if r.code != 0 {
+		return exitError(r.code)
+	}
+	return nil
+}
+
+// LookPath implements sh.PathFinder, so that sh.Require checks for the tools
+// the Fake has responses scripted for. A command is found, at its own name, if
+// a response that doesn't fail to run (see Err) is scripted for it.
+func (f *Fake) LookPath(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.responses {
+		if r.name == name && r.err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("shtest: no response scripted for %q", name)
+}
+
+func (f *Fake) match(call Call) *Response {
+	for _, r := range f.responses {
+		if r.name != call.Name || len(r.args) > len(call.Args) {
+			continue
+		}
+		ok := true
+		for i, a := range r.args {
+			if call.Args[i] != a {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// Calls returns the commands run so far, in the order they were run.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Commands returns the command lines of the commands run so far, in the order
+// they were run.
+func (f *Fake) Commands() []string {
+	var cmds []string
+	for _, c := range f.Calls() {
+		cmds = append(cmds, c.String())
+	}
+	return cmds
+}
+
+// Context returns a context that makes the commands run with it use the Fake.
+// See sh.WithExecutor.
+func (f *Fake) Context(ctx context.Context) context.Context {
+	return sh.WithExecutor(ctx, f)
+}
+
+// Install makes the Fake the executor of every command for the rest of the
+// test, including commands run without a context. See sh.SetExecutor.
+func (f *Fake) Install(t testing.TB) {
+	t.Cleanup(sh.SetExecutor(f))
+}
+
+// exitError is the error of a command scripted to exit with a non-zero code.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (e exitError) ExitStatus() int {
+	return int(e)
+}
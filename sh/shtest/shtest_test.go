@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package shtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/actualyze-ai/mage/sh"
+)
+
+func TestFake(t *testing.T) {
+	fake := New()
+	fake.On("go", "list").Stdout("a\nb\n")
+	fake.On("go", "test").Exit(3)
+	ctx := fake.Context(context.Background())
+
+	lines, err := sh.Command("go", "list", "./...").Dir("pkg").Env("CGO_ENABLED", "0").Lines(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected scripted output %q, got %q", want, lines)
+	}
+
+	err = sh.RunCtx(ctx, "go", "test", "./...")
+	if sh.ExitStatus(err) != 3 || !sh.CmdRan(err) {
+		t.Fatalf("expected the command to run and exit with 3, got %v", err)
+	}
+
+	err = sh.RunCtx(ctx, "rm", "-rf", "/")
+	if err == nil || sh.CmdRan(err) {
+		t.Fatalf("expected an unscripted command to fail to run, got %v", err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(calls))
+	}
+	if calls[0].Dir != "pkg" || calls[0].Env["CGO_ENABLED"] != "0" {
+		t.Fatalf("expected the dir and env to be recorded, got %+v", calls[0])
+	}
+	want := []string{"go list ./...", "go test ./...", "rm -rf /"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected commands %q, got %q", want, got)
+	}
+}
+
+func TestFakeInstall(t *testing.T) {
+	fake := New()
+	fake.On("git", "rev-parse").Stdout("abc123\n")
+	t.Run("installed", func(t *testing.T) {
+		fake.Install(t)
+		out, err := sh.Output("git", "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "abc123" {
+			t.Fatalf("expected scripted output, got %q", out)
+		}
+	})
+	if _, err := sh.Output("thiscommanddoesnotexist"); sh.CmdRan(err) {
+		t.Fatalf("expected the fake to be uninstalled after the test, got %v", err)
+	}
+	if got := fake.Commands(); len(got) != 1 {
+		t.Fatalf("expected only the command run while installed, got %q", got)
+	}
+}
+
+func TestFakeRequire(t *testing.T) {
+	fake := New()
+	fake.On("protoc", "--version").Stdout("libprotoc 3.21.12\n")
+	fake.On("docker").Err(errors.New("not installed"))
+	fake.Install(t)
+
+	if err := sh.Require("protoc >= 3.21"); err != nil {
+		t.Fatal(err)
+	}
+	err := sh.Require("protoc >= 4", "docker", "node")
+	var re *sh.RequireError
+	if !errors.As(err, &re) || len(re.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", err)
+	}
+	// the version is asked for every time, rather than cached like the
+	// versions of real tools.
+	want := []string{"protoc --version", "protoc --version"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected commands %q, got %q", want, got)
+	}
+}
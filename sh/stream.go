@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Line is a line of output of a command run with Stream.
+type Line struct {
+	Stream string    // "stdout" or "stderr"
+	Text   string    // the line, without its line ending
+	Time   time.Time // when the line was written
+}
+
+// Stream runs the command and calls fn with each line it writes to stdout and
+// stderr, as it writes them, e.g. to parse the events of "go test -json" or to
+// show progress:
+//
+//	err := sh.Stream(ctx, "go", []string{"test", "-json", "./..."}, func(l sh.Line) error {
+//		var ev testEvent
+//		if err := json.Unmarshal([]byte(l.Text), &ev); err != nil {
+//			return nil // not an event
+//		}
+//		return report(ev)
+//	})
+//
+// The command is run like ExecCtx runs it, except that its output only goes to
+// fn. fn is never called concurrently, and the command can't write more output
+// than the pipe holds until fn returns, so a slow fn slows down the command
+// rather than piling up its output. If fn returns an error, the command is
+// stopped like ExecCtx stops it when its context is done, and Stream returns
+// that error.
+func Stream(ctx context.Context, cmd string, args []string, fn func(Line) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var mu sync.Mutex
+	var fnErr error
+	writer := func(stream string) *lineWriter {
+		return &lineWriter{fn: func(text string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if fnErr != nil {
+				return fnErr
+			}
+			if err := fn(Line{Stream: stream, Text: text, Time: time.Now()}); err != nil {
+				fnErr = err
+				cancel(err)
+				return err
+			}
+			return nil
+		}}
+	}
+	stdout, stderr := writer("stdout"), writer("stderr")
+	_, err := execute(ctx, &Invocation{
+		Name:   cmd,
+		Args:   append([]string(nil), args...),
+		Stdin:  os.Stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	// the last lines may have no line ending.
+	if ferr := stdout.flush(); err == nil {
+		err = ferr
+	}
+	if ferr := stderr.flush(); err == nil {
+		err = ferr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
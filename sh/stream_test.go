@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	var stdout, stderr []string
+	args := []string{"-helper", "-stdout", "one\ntwo", "-stderr", "oops", "-exit", "2"}
+	err := Stream(context.Background(), os.Args[0], args, func(l Line) error {
+		if l.Time.IsZero() {
+			t.Errorf("expected line %q to have a time", l.Text)
+		}
+		switch l.Stream {
+		case "stdout":
+			stdout = append(stdout, l.Text)
+		case "stderr":
+			stderr = append(stderr, l.Text)
+		default:
+			t.Errorf("unexpected stream %q", l.Stream)
+		}
+		return nil
+	})
+	if ExitStatus(err) != 2 {
+		t.Fatalf("expected exit status 2, got %v", err)
+	}
+	if want := []string{"one", "two"}; !reflect.DeepEqual(stdout, want) {
+		t.Fatalf("expected stdout lines %q, got %q", want, stdout)
+	}
+	if want := []string{"oops"}; !reflect.DeepEqual(stderr, want) {
+		t.Fatalf("expected stderr lines %q, got %q", want, stderr)
+	}
+}
+
+func TestStreamAbort(t *testing.T) {
+	errFound := errors.New("found it")
+	start := time.Now()
+	aborted := false
+	args := []string{"-helper", "-stdout", "ready\nmore", "-linger", "1m"}
+	err := Stream(context.Background(), os.Args[0], args, func(l Line) error {
+		if aborted {
+			t.Errorf("unexpected call with %q after the callback failed", l.Text)
+		}
+		if l.Text == "ready" {
+			aborted = true
+			return errFound
+		}
+		return nil
+	})
+	if err != errFound {
+		t.Fatalf("expected the error returned by the callback, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected the command to be stopped, took %v", d)
+	}
+}
@@ -3,17 +3,32 @@ package sh
 import (
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
 	"testing"
+	"time"
 )
 
 var (
-	helperCmd bool
-	printArgs bool
-	stderr    string
-	stdout    string
-	exitCode  int
-	printVar  string
+	helperCmd  bool
+	printArgs  bool
+	stderr     string
+	stdout     string
+	exitCode   int
+	printVar   string
+	sleep      time.Duration
+	ignoreTerm bool
+	printWd    bool
+	cat        bool
+	listen     bool
+	touch      string
+	linger     time.Duration
+	partial    string
+	orphan     time.Duration
 )
 
 func init() {
@@ -23,6 +38,15 @@ func init() {
 	flag.StringVar(&stdout, "stdout", "", "")
 	flag.IntVar(&exitCode, "exit", 0, "")
 	flag.StringVar(&printVar, "printVar", "", "")
+	flag.DurationVar(&sleep, "sleep", 0, "")
+	flag.BoolVar(&ignoreTerm, "ignoreTerm", false, "")
+	flag.BoolVar(&printWd, "printWd", false, "")
+	flag.BoolVar(&cat, "cat", false, "")
+	flag.BoolVar(&listen, "listen", false, "")
+	flag.StringVar(&touch, "touch", "", "")
+	flag.DurationVar(&linger, "linger", 0, "")
+	flag.StringVar(&partial, "partial", "", "")
+	flag.DurationVar(&orphan, "orphan", 0, "")
 }
 
 func TestMain(m *testing.M) {
@@ -32,14 +56,52 @@ func TestMain(m *testing.M) {
 		fmt.Println(flag.Args())
 		return
 	}
+	if printWd {
+		wd, _ := os.Getwd()
+		fmt.Println(wd)
+		return
+	}
+	if cat {
+		_, _ = io.Copy(os.Stdout, os.Stdin)
+		return
+	}
 	if printVar != "" {
 		fmt.Println(os.Getenv(printVar))
 		return
 	}
 
 	if helperCmd {
+		if ignoreTerm {
+			signal.Ignore(syscall.SIGTERM)
+		}
+		if listen {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println("listening on", ln.Addr())
+		}
+		if touch != "" {
+			if err := os.WriteFile(touch, nil, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if orphan > 0 {
+			// a process left behind that keeps stdout and stderr open.
+			c := exec.Command(os.Args[0], "-helper", "-sleep", orphan.String())
+			c.Stdout, c.Stderr = os.Stdout, os.Stderr
+			if err := c.Start(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		time.Sleep(sleep)
 		fmt.Fprintln(os.Stderr, stderr)
 		fmt.Fprintln(os.Stdout, stdout)
+		fmt.Fprint(os.Stdout, partial)
+		time.Sleep(linger)
 		os.Exit(exitCode)
 	}
 	os.Exit(m.Run())
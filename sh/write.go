@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// WriteFileAtomic writes data to the file path with permissions perm, like
+// os.WriteFile, except that readers see either the old contents or the new,
+// never a partly written file, even if mage is interrupted. The data is written
+// to a temporary file in the same directory, flushed to disk, and renamed over
+// path.
+func WriteFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	if mg.Verbose() {
+		log.Printf("write: %s", path)
+	}
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf(`can't write %s: %v`, path, err)
+	}
+	tmp := f.Name()
+	err = func() error {
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Chmod(perm); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf(`can't write %s: %v`, path, err)
+	}
+	// make the rename itself durable. Directories can't be synced everywhere,
+	// and the file is in place either way, so errors are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// WriteIfChanged atomically writes data to the file path unless it already
+// holds exactly that, in which case the file, including its modification time,
+// is left alone, so that target.Path and friends don't consider everything
+// built from it out of date. An existing file keeps its permissions and a new
+// one gets 0644. It reports whether the file was written.
+func WriteIfChanged(path string, data []byte) (bool, error) {
+	perm := fs.FileMode(0o644)
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+		if info.Size() == int64(len(data)) {
+			old, err := os.ReadFile(path)
+			if err != nil {
+				return false, fmt.Errorf(`can't read %s: %v`, path, err)
+			}
+			if bytes.Equal(old, data) {
+				return false, nil
+			}
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, fmt.Errorf(`can't stat %s: %v`, path, err)
+	}
+	if err := WriteFileAtomic(path, data, perm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
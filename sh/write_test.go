@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package sh
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "version.go")
+	if err := os.WriteFile(name, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(name, []byte("package version"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package version" {
+		t.Fatalf("expected new contents, got %q", b)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected permissions 0600, got %#o", info.Mode().Perm())
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected no temporary files to be left behind, got %v", entries)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "f"), nil, 0o644); err == nil {
+		t.Fatal("expected an error writing to a missing directory")
+	}
+}
+
+func TestWriteIfChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	changed, err := WriteIfChanged(name, []byte("{}"))
+	if err != nil || !changed {
+		t.Fatalf("expected a new file to be written, got %v, %v", changed, err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err = WriteIfChanged(name, []byte("{}"))
+	if err != nil || changed {
+		t.Fatalf("expected identical contents not to be written, got %v, %v", changed, err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Fatalf("expected modification time %v to be kept, got %v", old, info.ModTime())
+	}
+
+	changed, err = WriteIfChanged(name, []byte("{ }"))
+	if err != nil || !changed {
+		t.Fatalf("expected different contents to be written, got %v, %v", changed, err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{ }" {
+		t.Fatalf("expected new contents, got %q", b)
+	}
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package target
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/actualyze-ai/mage/internal"
+)
+
+// GlobOptions controls how GlobFiles finds files.
+type GlobOptions struct {
+	// GitIgnore leaves out the files that .gitignore files ignore, and the
+	// .git directory, without searching ignored directories. The .gitignore
+	// files in the directories above a file are used, starting from the
+	// working directory for files under it.
+	GitIgnore bool
+}
+
+// GlobFiles returns the sorted files and directories that match the patterns.
+// Patterns are matched like filepath.Glob, with some additions:
+//
+//   - a "**" path element matches any number of directories, so "**/*.go"
+//     matches every go file in the tree,
+//   - braces match any of the comma separated alternatives in them, so
+//     "*.{go,mod}" matches go files and go.mod,
+//   - a pattern that starts with "!" excludes what it matches, and everything
+//     under it, from the other patterns' matches, whatever the order of the
+//     patterns, as in "**/*.go", "!**/testdata".
+//
+// It is an error for a pattern other than an exclude to match nothing.
+func GlobFiles(opts GlobOptions, patterns ...string) ([]string, error) {
+	var skip func(name string, isDir bool) bool
+	if opts.GitIgnore {
+		skip = newGitIgnore().ignored
+	}
+	var excludes [][]string
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			for _, alt := range internal.ExpandBraces(p[1:]) {
+				excludes = append(excludes, splitPath(alt))
+			}
+		}
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			continue
+		}
+		found := false
+		for _, alt := range internal.ExpandBraces(p) {
+			matches, err := internal.GlobSkip(alt, skip)
+			if err != nil {
+				return nil, err
+			}
+			found = found || len(matches) > 0
+			for _, m := range matches {
+				if !seen[m] && !excluded(excludes, m) {
+					seen[m] = true
+					files = append(files, m)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("glob didn't match any files: %s", p)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// splitPath splits a file path or pattern into its slash-separated elements.
+func splitPath(name string) []string {
+	return strings.Split(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+// excluded reports whether name, or a directory above it, matches one of the
+// exclude patterns.
+func excluded(excludes [][]string, name string) bool {
+	parts := splitPath(name)
+	for _, ex := range excludes {
+		for i := 1; i <= len(parts); i++ {
+			if internal.MatchGlob(ex, parts[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gitIgnore matches files against the .gitignore files above them, which it
+// reads once each.
+type gitIgnore struct {
+	rules map[string][]ignoreRule // by directory
+}
+
+// ignoreRule is a line of a .gitignore file.
+type ignoreRule struct {
+	pattern  []string
+	anchored bool // matched against the whole path, rather than the name
+	negate   bool
+	dirOnly  bool
+}
+
+func newGitIgnore() *gitIgnore {
+	return &gitIgnore{rules: map[string][]ignoreRule{}}
+}
+
+// ignored reports whether name, or a directory above it, is ignored.
+func (g *gitIgnore) ignored(name string, isDir bool) bool {
+	parts := splitPath(name)
+	// .gitignore files count from the working directory down, or from the
+	// top for paths outside of it.
+	top := 0
+	if filepath.IsAbs(name) || parts[0] == ".." {
+		top = 1
+	}
+	for i := 1; i <= len(parts); i++ {
+		dir := i < len(parts) || isDir
+		if parts[i-1] == ".git" && dir {
+			return true
+		}
+		if g.match(parts[:i], top, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the rules of the .gitignore files in the directories above
+// the path, from the top down, so that the last rule that matches decides.
+func (g *gitIgnore) match(parts []string, top int, isDir bool) bool {
+	ignored := false
+	for d := top; d < len(parts); d++ {
+		rel := parts[d:]
+		for _, r := range g.load(parts[:d]) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			var ok bool
+			if r.anchored {
+				ok = internal.MatchGlob(r.pattern, rel)
+			} else {
+				ok, _ = path.Match(r.pattern[0], rel[len(rel)-1])
+			}
+			if ok {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// load returns the rules in the .gitignore file of the directory with the
+// given path elements, where none is the working directory.
+func (g *gitIgnore) load(dir []string) []ignoreRule {
+	key := strings.Join(dir, "/")
+	if len(dir) == 1 && filepath.IsAbs(dir[0]+"/") {
+		// the root, like "/" or "C:/".
+		key += "/"
+	}
+	if rules, ok := g.rules[key]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	if f, err := os.Open(filepath.Join(filepath.FromSlash(key), ".gitignore")); err == nil {
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if r, ok := parseIgnoreRule(s.Text()); ok {
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+	g.rules[key] = rules
+	return rules
+}
+
+// parseIgnoreRule parses a line of a .gitignore file, reporting false for
+// blank lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	r.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = strings.Split(line, "/")
+	return r, true
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package target
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// globTree creates the files, given by slash-separated path, under a new
+// directory, and returns it.
+func globTree(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// relFiles returns the files relative to dir, with forward slashes.
+func relFiles(t *testing.T, dir string, files []string) []string {
+	t.Helper()
+	var rel []string
+	for _, f := range files {
+		r, err := filepath.Rel(dir, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	return rel
+}
+
+func TestGlobFiles(t *testing.T) {
+	t.Parallel()
+	dir := globTree(t,
+		"go.mod",
+		"main.go",
+		"main_test.go",
+		"README.md",
+		"pkg/lib.go",
+		"pkg/testdata/fixture.go",
+		"pkg/sub/deep.go",
+		"web/app.ts",
+		"web/app.js",
+	)
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"*.go"}, []string{"main.go", "main_test.go"}},
+		{[]string{"**/*.go"}, []string{"main.go", "main_test.go", "pkg/lib.go", "pkg/sub/deep.go", "pkg/testdata/fixture.go"}},
+		{[]string{"**/*.go", "!**/testdata", "!*_test.go"}, []string{"main.go", "pkg/lib.go", "pkg/sub/deep.go"}},
+		{[]string{"!pkg/sub", "pkg/**/*.go"}, []string{"pkg/lib.go", "pkg/testdata/fixture.go"}},
+		{[]string{"*.{mod,md}", "web/app.{ts,js}"}, []string{"README.md", "go.mod", "web/app.js", "web/app.ts"}},
+		{[]string{"pkg/{lib,sub/{deep,missing}}.go"}, []string{"pkg/lib.go", "pkg/sub/deep.go"}},
+		{[]string{"main.go", "*.go"}, []string{"main.go", "main_test.go"}},
+	}
+	for _, tt := range tests {
+		var patterns []string
+		for _, p := range tt.patterns {
+			if p[0] == '!' {
+				patterns = append(patterns, "!"+filepath.Join(dir, p[1:]))
+			} else {
+				patterns = append(patterns, filepath.Join(dir, p))
+			}
+		}
+		files, err := GlobFiles(GlobOptions{}, patterns...)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.patterns, err)
+		}
+		if got := relFiles(t, dir, files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.patterns, tt.want, got)
+		}
+	}
+
+	if _, err := GlobFiles(GlobOptions{}, filepath.Join(dir, "**/*.rs")); err == nil {
+		t.Error("expected an error for a glob that matches nothing")
+	}
+	if _, err := GlobFiles(GlobOptions{}, filepath.Join(dir, "*.go"), "!"+filepath.Join(dir, "*.go")); err != nil {
+		t.Errorf("expected no error when everything is excluded, got %v", err)
+	}
+}
+
+func TestGlobFilesGitIgnore(t *testing.T) {
+	t.Parallel()
+	dir := globTree(t,
+		"main.go",
+		"debug.log",
+		"bin/tool.go",
+		"pkg/lib.go",
+		"pkg/gen.go",
+		"pkg/keep.log",
+		".git/hooks/pre-commit.go",
+	)
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "# build output\n*.log\n/bin/\n")
+	write("pkg/.gitignore", "gen.go\n!keep.log\n")
+
+	files, err := GlobFiles(GlobOptions{GitIgnore: true}, filepath.Join(dir, "**/*.{go,log}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"main.go", "pkg/keep.log", "pkg/lib.go"}
+	if got := relFiles(t, dir, files); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	files, err = GlobFiles(GlobOptions{}, filepath.Join(dir, "**/*.{go,log}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 7 {
+		t.Fatalf("expected .gitignore files to be ignored by default, got %q", relFiles(t, dir, files))
+	}
+}
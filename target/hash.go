@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package target
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// Manifest holds the digests of the sources of a destination, as returned by
+// PathHash, DirHash and GlobHash. Call Save once the destination has been
+// built successfully, so that the next check compares against these sources.
+type Manifest struct {
+	path  string
+	state manifestState
+}
+
+type manifestState struct {
+	Dst   string                   `json:"dst"`
+	Files map[string]manifestEntry `json:"files"`
+}
+
+// manifestEntry records a file's digest.
+type manifestEntry struct {
+	Digest string `json:"digest"`
+}
+
+// Save records the digests as those the destination was built from.
+func (m *Manifest) Save() error {
+	b, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return fmt.Errorf("can't save hashes of %s: %v", m.state.Dst, err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("can't save hashes of %s: %v", m.state.Dst, err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("can't save hashes of %s: %v", m.state.Dst, err)
+	}
+	return nil
+}
+
+// PathHash is like Path, except that it compares the contents of the sources
+// instead of their modification times, so that it isn't fooled by a fresh
+// checkout or a restored CI cache. It reports the destination as out of date
+// if it doesn't exist, or if any source was added, removed or changed since
+// the last time the returned Manifest was saved. Like Path, it doesn't descend
+// into directories, which only change when entries are added or removed.
+//
+// The digests are kept under mg.CacheDir(), keyed by the absolute path of the
+// destination.
+//
+//	rebuild, m, err := target.PathHash("bin/app", "main.go", "go.sum")
+//	if err != nil || !rebuild {
+//		return err
+//	}
+//	if err := sh.Run("go", "build", "-o", "bin/app"); err != nil {
+//		return err
+//	}
+//	return m.Save()
+func PathHash(dst string, sources ...string) (bool, *Manifest, error) {
+	return checkHashes(dst, func(add addFunc) error {
+		for _, source := range sources {
+			if err := add(os.ExpandEnv(source)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GlobHash is like PathHash for the files that the globs match, the way Glob
+// is like Path. It is an error for any glob other than an exclude to match no
+// files.
+func GlobHash(dst string, globs ...string) (bool, *Manifest, error) {
+	return checkHashes(dst, func(add addFunc) error {
+		files, err := GlobFiles(GlobOptions{}, globs...)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := add(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DirHash is like PathHash, except that sources that are directories are
+// searched recursively, and every file in them is compared.
+func DirHash(dst string, sources ...string) (bool, *Manifest, error) {
+	return checkHashes(dst, func(add addFunc) error {
+		for _, source := range sources {
+			err := filepath.WalkDir(os.ExpandEnv(source), func(name string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				return add(name)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addFunc adds the digest of a source to a manifest.
+type addFunc func(name string) error
+
+// checkHashes hashes the sources that list adds, and compares them to those
+// saved for dst.
+func checkHashes(dst string, list func(add addFunc) error) (bool, *Manifest, error) {
+	dst = os.ExpandEnv(dst)
+	abs, err := filepath.Abs(dst)
+	if err != nil {
+		return false, nil, err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	m := &Manifest{
+		path:  filepath.Join(mg.CacheDir(), "targets", hex.EncodeToString(sum[:])+".json"),
+		state: manifestState{Dst: abs, Files: map[string]manifestEntry{}},
+	}
+	prev := readManifest(m.path)
+
+	// every source is hashed on every check, since an edit that keeps the
+	// size can't be told apart by modification time when it lands within
+	// the filesystem's timestamp granularity, or when the time is restored.
+	err = list(func(name string) error {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		var e manifestEntry
+		if e.Digest, err = digest(name, info); err != nil {
+			return err
+		}
+		m.state.Files[filepath.ToSlash(name)] = e
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	if _, err := os.Stat(dst); errors.Is(err, fs.ErrNotExist) {
+		return true, m, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+	if prev.Dst != abs || len(prev.Files) != len(m.state.Files) {
+		return true, m, nil
+	}
+	for key, e := range m.state.Files {
+		if p, ok := prev.Files[key]; !ok || p.Digest != e.Digest {
+			return true, m, nil
+		}
+	}
+	return false, m, nil
+}
+
+// readManifest returns the saved state at path. A missing or unreadable one
+// is empty, which makes everything out of date.
+func readManifest(path string) manifestState {
+	var s manifestState
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s
+	}
+	if json.Unmarshal(b, &s) != nil {
+		return manifestState{}
+	}
+	return s
+}
+
+// digest returns the sha256 of the file name, or of the sorted names in it if
+// it is a directory.
+func digest(name string, info fs.FileInfo) (string, error) {
+	h := sha256.New()
+	if info.IsDir() {
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			return "", err
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		sort.Strings(names)
+		io.WriteString(h, "dir\x00"+strings.Join(names, "\x00"))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
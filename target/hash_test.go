@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2026 Actualyze AI
+
+package target
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/actualyze-ai/mage/mg"
+)
+
+// checkStale fails the test if check's staleness isn't want, and returns the
+// manifest.
+func checkStale(t *testing.T, want bool, check func() (bool, *Manifest, error)) *Manifest {
+	t.Helper()
+	stale, m, err := check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale != want {
+		t.Fatalf("expected stale to be %v, got %v", want, stale)
+	}
+	return m
+}
+
+func TestPathHash(t *testing.T) {
+	t.Setenv(mg.CacheEnv, t.TempDir())
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() (bool, *Manifest, error) { return PathHash(dst, src) }
+
+	// the destination is missing.
+	m := checkStale(t, true, check)
+	if err := os.WriteFile(dst, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// nothing was saved yet.
+	checkStale(t, true, check)
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+
+	// a new modification time alone, like after a checkout, isn't a change.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(src, later, later); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+
+	// an edit that keeps the size and the modification time is a change.
+	if err := os.WriteFile(src, []byte("v3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(src, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, true, check)
+
+	if err := os.WriteFile(src, []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m = checkStale(t, true, check)
+	// until the build succeeds, the destination stays out of date.
+	checkStale(t, true, check)
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+
+	// a different set of sources is a change too.
+	other := filepath.Join(dir, "other")
+	if err := os.WriteFile(other, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, true, func() (bool, *Manifest, error) { return PathHash(dst, src, other) })
+
+	if _, _, err := PathHash(dst, filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing source to be an os.IsNotExist error, got %v", err)
+	}
+}
+
+func TestDirHash(t *testing.T) {
+	t.Setenv(mg.CacheEnv, t.TempDir())
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	deep := filepath.Join(src, "sub", "deep.txt")
+	if err := os.WriteFile(deep, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check := func() (bool, *Manifest, error) { return DirHash(dst, src) }
+	if err := checkStale(t, true, check).Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+
+	if err := os.WriteFile(deep, []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStale(t, true, check).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "new.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, true, check)
+}
+
+func TestGlobHash(t *testing.T) {
+	t.Setenv(mg.CacheEnv, t.TempDir())
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check := func() (bool, *Manifest, error) { return GlobHash(dst, filepath.Join(dir, "*.go")) }
+	if err := checkStale(t, true, check).Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+
+	// files the globs don't match don't matter.
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, false, check)
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkStale(t, true, check)
+
+	if _, _, err := GlobHash(dst, filepath.Join(dir, "*.rs")); err == nil {
+		t.Fatal("expected an error for a glob that matches nothing")
+	}
+}
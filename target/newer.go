@@ -44,27 +44,15 @@ func DirNewer(target time.Time, sources ...string) (bool, error) {
 	return false, nil
 }
 
-// GlobNewer performs glob expansion on each source and passes the results to
-// PathNewer for inspection. It returns the first time PathNewer encounters a
-// newer file
+// GlobNewer expands the globs like GlobFiles, with its "**", brace and "!"
+// exclude syntax, and passes the results to PathNewer for inspection. It is an
+// error for any glob other than an exclude to match no files.
 func GlobNewer(target time.Time, sources ...string) (bool, error) {
-	for _, g := range sources {
-		files, err := filepath.Glob(g)
-		if err != nil {
-			return false, err
-		}
-		if len(files) == 0 {
-			return false, fmt.Errorf("glob didn't match any files: %s", g)
-		}
-		newer, err := PathNewer(target, files...)
-		if err != nil {
-			return false, err
-		}
-		if newer {
-			return true, nil
-		}
+	files, err := GlobFiles(GlobOptions{}, sources...)
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+	return PathNewer(target, files...)
 }
 
 // PathNewer checks whether any of the sources are newer than the target time.
@@ -1,3 +1,9 @@
+// SPDX-License-Identifier: Apache-2.0
+// Modifications Copyright (c) 2026 Actualyze AI
+//
+// NOTE: This file has been modified by Actualyze AI from the original upstream
+// version (magefile/mage). See git history for details.
+
 package target
 
 import (
@@ -24,7 +30,8 @@ func Path(dst string, sources ...string) (bool, error) {
 // Glob expands each of the globs (file patterns) into individual sources and
 // then calls Path on the result, reporting if any of the resulting sources have
 // been modified more recently than the destination. Syntax for Glob patterns is
-// the same as stdlib's filepath.Glob. Note that Glob does not expand
+// that of stdlib's filepath.Glob, plus the "**", brace and "!" exclude syntax
+// described at GlobFiles. Note that Glob does not expand
 // environment variables before globbing -- env var expansion happens during
 // the call to Path. It is an error for any glob to return an empty result.
 func Glob(dst string, globs ...string) (bool, error) {